@@ -0,0 +1,52 @@
+// Command emulator-data downloads the latest emulator dataset. By default it refreshes the snapshot
+// embedded into util/injections, with -cache it fills the on-disk cache instead.
+//
+//	go run ./cmd/emulator-data
+//	go run ./cmd/emulator-data -cache -versions 2
+//	go run ./cmd/emulator-data -platforms as-windows-10,as-windows-11
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	util "github.com/dovydasdo/psec/util/injections"
+)
+
+func main() {
+	out := flag.String("out", "util/injections/data", "directory to write the dataset to")
+	cache := flag.Bool("cache", false, "write to the default cache directory instead of -out")
+	versions := flag.Int("versions", 4, "number of the latest major versions to keep")
+	platforms := flag.String("platforms", strings.Join(osDirs(), ","), "comma separated os directories of the dataset")
+	baseURL := flag.String("url", util.EmulatorDataURL, "base url of the dataset")
+	timeout := flag.Duration("timeout", util.DefaultHTTPTimeout, "timeout of a single download")
+	flag.Parse()
+
+	dir := *out
+	if *cache {
+		dir = util.DefaultCacheDir()
+	}
+
+	source := util.NewHTTPSource()
+	source.BaseURL = *baseURL
+	source.Client.Timeout = *timeout
+
+	start := time.Now()
+	latest, err := util.Refresh(source, dir, *versions, strings.Split(*platforms, ",")...)
+	if err != nil {
+		log.Fatalf("failed to refresh emulator data: %v", err)
+	}
+
+	log.Printf("downloaded versions %v to %v in %v", latest, dir, time.Since(start))
+}
+
+// osDirs are the directories of every os profiles can be generated for, the snapshot needs all of them
+func osDirs() []string {
+	dirs := make([]string, 0, len(util.OSProfiles))
+	for _, os := range util.OSProfiles {
+		dirs = append(dirs, os.Dir)
+	}
+	return dirs
+}
@@ -0,0 +1,87 @@
+// Command selftest runs a CDPContext against the local detection pages of pkg/selftest and prints
+// which checks pass. It exits with status 1 if any check fails.
+//
+//	go run ./cmd/selftest -bin /usr/bin/google-chrome
+//	go run ./cmd/selftest -os macos -without plugins,permissions
+//	go run ./cmd/selftest -remote ws://127.0.0.1:9222 -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	requestcontext "github.com/dovydasdo/psec/pkg/request_context"
+	"github.com/dovydasdo/psec/pkg/selftest"
+)
+
+func main() {
+	bin := flag.String("bin", "", "browser binary, the default chrome if empty")
+	injection := flag.String("injection", "", "script used instead of the embedded stealth bundle")
+	without := flag.String("without", "", "comma separated stealth modules to disable")
+	remote := flag.String("remote", "", "url of a running browser to connect to instead of launching one")
+	token := flag.String("token", "", "token of the remote browser")
+	headless := flag.Bool("headless", true, "run the launched browser headless")
+	osName := flag.String("os", "", "os of the fingerprint profile, picked by weight if empty")
+	url := flag.String("url", "", "detection page to load instead of the local one")
+	timeout := flag.Duration("timeout", selftest.DefaultTimeout, "timeout of the page checks")
+	asJSON := flag.Bool("json", false, "print the report as json")
+	verbose := flag.Bool("v", false, "log the browser events")
+	flag.Parse()
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelDebug
+	}
+
+	options := []requestcontext.CDPOption{
+		requestcontext.WithBinPath(*bin),
+		requestcontext.WithInjectionPath(*injection),
+		requestcontext.WithRemoteURL(*remote),
+		requestcontext.WithRemoteToken(*token),
+		requestcontext.WithHeadless(*headless),
+		requestcontext.WithTimeout(*timeout),
+		requestcontext.WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))),
+	}
+	if *without != "" {
+		options = append(options, requestcontext.WithoutStealthModules(strings.Split(*without, ",")...))
+	}
+	if *osName != "" {
+		options = append(options, requestcontext.WithOS(*osName))
+	}
+
+	loader := requestcontext.GetCDPContext(requestcontext.NewCDPOptions(options...))
+	if err := loader.Initialize(); err != nil {
+		log.Fatalf("failed to start the browser: %v", err)
+	}
+
+	start := time.Now()
+	var report *selftest.Report
+	var err error
+	if *url != "" {
+		report, err = selftest.Run(loader, *url, *timeout)
+	} else {
+		report, err = selftest.RunLocal(loader, *timeout)
+	}
+	loader.Close()
+
+	if err != nil {
+		log.Fatalf("self-test failed after %v: %v", time.Since(start), err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		report.Print(os.Stdout)
+	}
+
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
@@ -36,6 +36,7 @@ type ConfTurso struct {
 }
 
 type ConfBrowserless struct {
+	URL   string `env:"BROWSERLESS_URL,default=wss://chrome.browserless.io"`
 	Token string `env:"BROWSERLESS_TOKEN,required"`
 	Proxy ProxyConf
 }
@@ -43,7 +44,7 @@ type ConfBrowserless struct {
 type ConfCDPLaunch struct {
 	Proxy         ProxyConf
 	BinPath       string `env:"CDP_BIN_PATH,required"`
-	InjectionPath string `env:"INJECTION_PATH,required"`
+	InjectionPath string `env:"INJECTION_PATH"`
 }
 
 type ConfBDProxy struct {
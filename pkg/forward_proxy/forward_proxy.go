@@ -0,0 +1,352 @@
+// Package forwardproxy is a local http proxy that forwards to an upstream chosen per connection. The
+// browser keeps pointing at it while the upstream changes, and the traffic is counted per upstream.
+package forwardproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Traffic is counted on the connections to the upstream, headers and tls included
+type Traffic struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+type counter struct {
+	sent     int64
+	received int64
+}
+
+type Proxy struct {
+	opts   *Options
+	logger *slog.Logger
+	dialer *net.Dialer
+
+	listener net.Listener
+	server   *http.Server
+
+	mu         sync.Mutex
+	traffic    map[string]*counter
+	transports map[string]*cachedTransport
+}
+
+// cachedTransport remembers the password it was built with, the key of an upstream does not have it
+type cachedTransport struct {
+	*http.Transport
+	password string
+}
+
+// hopHeaders only apply to a single connection and are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func New(opts *Options) *Proxy {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Proxy{
+		opts:       opts,
+		logger:     logger,
+		dialer:     &net.Dialer{Timeout: opts.DialTimeout},
+		traffic:    make(map[string]*counter),
+		transports: make(map[string]*cachedTransport),
+	}
+}
+
+// Start listens on Addr and serves in the background until Close
+func (p *Proxy) Start() error {
+	listener, err := net.Listen("tcp", p.opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	p.listener = listener
+	p.server = &http.Server{Handler: p}
+
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Error("proxy", "message", "proxy stopped", "error", err)
+		}
+	}()
+
+	p.logger.Debug("proxy", "message", "forwarding proxy started", "addr", listener.Addr().String())
+	return nil
+}
+
+// URL is the address to point the browser at
+func (p *Proxy) URL() string {
+	if p.listener == nil {
+		return ""
+	}
+	return "http://" + p.listener.Addr().String()
+}
+
+func (p *Proxy) Close() error {
+	if p.server == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	for _, transport := range p.transports {
+		transport.CloseIdleConnections()
+	}
+	p.mu.Unlock()
+
+	// Tunnels are hijacked, the server does not wait for them
+	return p.server.Close()
+}
+
+// Traffic returns the bytes sent and received per upstream key
+func (p *Proxy) Traffic() map[string]Traffic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	traffic := make(map[string]Traffic, len(p.traffic))
+	for key, c := range p.traffic {
+		traffic[key] = Traffic{Sent: atomic.LoadInt64(&c.sent), Received: atomic.LoadInt64(&c.received)}
+	}
+
+	return traffic
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	upstream, err := p.upstream()
+	if err != nil {
+		p.logger.Warn("proxy", "message", "failed to get upstream", "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, upstream)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "this is a proxy, requests need an absolute url", http.StatusBadRequest)
+		return
+	}
+
+	p.forward(w, r, upstream)
+}
+
+// authorized checks the credentials of the client, every client is let through if none are set
+func (p *Proxy) authorized(r *http.Request) bool {
+	if p.opts.Username == "" && p.opts.Password == "" {
+		return true
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.opts.Username+":"+p.opts.Password))
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Proxy-Authorization")), []byte(expected)) == 1
+}
+
+func (p *Proxy) upstream() (*Upstream, error) {
+	if p.opts.Upstream == nil {
+		return nil, nil
+	}
+	return p.opts.Upstream()
+}
+
+// tunnel connects the client to the host of a CONNECT request, the bytes are passed through as they are
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request, upstream *Upstream) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.opts.DialTimeout)
+	defer cancel()
+
+	conn, err := upstream.dial(ctx, p.dialer, r.Host)
+	if err != nil {
+		p.logger.Warn("proxy", "message", "failed to open tunnel", "host", r.Host, "upstream", upstream.Key(), "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn = p.count(conn, upstream.Key())
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		conn.Close()
+		http.Error(w, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		conn.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(conn, buffered)
+		closeWrite(conn)
+	}()
+
+	io.Copy(client, conn)
+	client.Close()
+	conn.Close()
+}
+
+// forward sends a plain http request on, through the upstream proxy itself or a connection dialed through it
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, upstream *Upstream) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+
+	resp, err := p.transport(upstream).RoundTrip(out)
+	if err != nil {
+		p.logger.Warn("proxy", "message", "failed to forward request", "url", r.URL.String(), "upstream", upstream.Key(), "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// transport keeps the connections of the current upstream alive between requests. Transports of the
+// previous upstreams are dropped, and so is one built with a password that has changed since.
+func (p *Proxy) transport(upstream *Upstream) *http.Transport {
+	key := upstream.Key()
+	password := upstream.password()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, cached := range p.transports {
+		if k != key || cached.password != password {
+			cached.CloseIdleConnections()
+			delete(p.transports, k)
+		}
+	}
+
+	if cached, ok := p.transports[key]; ok {
+		return cached.Transport
+	}
+
+	// The agent may change the upstream it returned, the transport keeps the one it was built for
+	if upstream != nil {
+		built := *upstream
+		upstream = &built
+	}
+
+	transport := &http.Transport{
+		// An http upstream gets the request itself, the others tunnel the connection
+		Proxy: func(*http.Request) (*url.URL, error) {
+			return upstream.proxyURL(), nil
+		},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var conn net.Conn
+			var err error
+			if upstream.proxyURL() != nil {
+				conn, err = p.dialer.DialContext(ctx, network, addr)
+			} else {
+				conn, err = upstream.dial(ctx, p.dialer, addr)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return p.count(conn, key), nil
+		},
+		DisableCompression: true,
+		IdleConnTimeout:    p.opts.DialTimeout * 6,
+	}
+	p.transports[key] = &cachedTransport{Transport: transport, password: password}
+
+	return transport
+}
+
+func (p *Proxy) count(conn net.Conn, key string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.traffic[key]
+	if !ok {
+		c = &counter{}
+		p.traffic[key] = c
+	}
+
+	return &countingConn{Conn: conn, counter: c}
+}
+
+type countingConn struct {
+	net.Conn
+	counter *counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.counter.received, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.counter.sent, int64(n))
+	return n, err
+}
+
+// closeWrite lets the other side know the client is done while its answer can still be read
+func closeWrite(conn net.Conn) {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			c.CloseWrite()
+			return
+		case *countingConn:
+			conn = c.Conn
+		case *bufferedConn:
+			conn = c.Conn
+		default:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
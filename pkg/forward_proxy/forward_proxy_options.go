@@ -0,0 +1,66 @@
+package forwardproxy
+
+import (
+	"log/slog"
+	"time"
+)
+
+type Option func(opts *Options)
+
+type Options struct {
+	// Addr is where the proxy listens, only local connections should reach it
+	Addr string
+	// Upstream is asked for the upstream of every new connection, nil connects directly
+	Upstream UpstreamFunc
+	// Username and Password are required from clients as basic Proxy-Authorization. Without them any
+	// local process can send its traffic through the upstream, and its credentials, too
+	Username    string
+	Password    string
+	DialTimeout time.Duration
+	Logger      *slog.Logger
+}
+
+func NewOptions(setters ...Option) *Options {
+	opts := &Options{
+		// Defaults
+		Addr:        "127.0.0.1:0",
+		DialTimeout: 15 * time.Second,
+	}
+
+	for _, setter := range setters {
+		setter(opts)
+	}
+
+	return opts
+}
+
+func WithAddr(addr string) Option {
+	return func(opts *Options) {
+		opts.Addr = addr
+	}
+}
+
+func WithUpstream(upstream UpstreamFunc) Option {
+	return func(opts *Options) {
+		opts.Upstream = upstream
+	}
+}
+
+func WithCredentials(username, password string) Option {
+	return func(opts *Options) {
+		opts.Username = username
+		opts.Password = password
+	}
+}
+
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.DialTimeout = timeout
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(opts *Options) {
+		opts.Logger = logger
+	}
+}
@@ -0,0 +1,327 @@
+package forwardproxy
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func startProxy(t *testing.T, upstream UpstreamFunc) *Proxy {
+	t.Helper()
+
+	proxy := New(NewOptions(WithUpstream(upstream)))
+	if err := proxy.Start(); err != nil {
+		t.Fatalf("failed to start proxy: %v", err)
+	}
+	t.Cleanup(func() { proxy.Close() })
+
+	return proxy
+}
+
+func get(t *testing.T, proxy *Proxy, target string) string {
+	t.Helper()
+
+	proxyURL, _ := url.Parse(proxy.URL())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("failed to get %v: %v", target, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %v: %s", resp.Status, body)
+	}
+
+	return string(body)
+}
+
+func origins(t *testing.T) (*httptest.Server, *httptest.Server) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" || r.Header.Get("Proxy-Connection") != "" {
+			http.Error(w, "proxy headers leaked", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	})
+
+	plain := httptest.NewServer(handler)
+	secure := httptest.NewTLSServer(handler)
+	t.Cleanup(func() {
+		plain.Close()
+		secure.Close()
+	})
+
+	return plain, secure
+}
+
+func TestDirect(t *testing.T) {
+	plain, secure := origins(t)
+	proxy := startProxy(t, nil)
+
+	if body := get(t, proxy, plain.URL); body != "hello" {
+		t.Errorf("unexpected body: %v", body)
+	}
+	if body := get(t, proxy, secure.URL); body != "hello" {
+		t.Errorf("unexpected body through the tunnel: %v", body)
+	}
+
+	traffic := proxy.Traffic()["direct"]
+	if traffic.Sent == 0 || traffic.Received == 0 {
+		t.Errorf("traffic was not counted: %+v", traffic)
+	}
+}
+
+func TestHTTPUpstream(t *testing.T) {
+	plain, secure := origins(t)
+
+	// The upstream is another forwarding proxy that requires auth
+	inner := New(NewOptions())
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="upstream"`)
+			http.Error(w, "auth required", http.StatusProxyAuthRequired)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	}))
+	defer upstreamServer.Close()
+
+	upstream, err := ParseUpstream("user:pass@" + upstreamServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to parse upstream: %v", err)
+	}
+
+	proxy := startProxy(t, func() (*Upstream, error) { return upstream, nil })
+
+	get(t, proxy, plain.URL)
+	get(t, proxy, secure.URL)
+
+	if _, ok := proxy.Traffic()[upstream.Key()]; !ok {
+		t.Errorf("traffic was not counted for %v: %v", upstream.Key(), proxy.Traffic())
+	}
+
+	upstream.Password = "wrong"
+	proxyURL, _ := url.Parse(proxy.URL())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if _, err := client.Get(secure.URL); err == nil {
+		t.Errorf("expected the tunnel to fail with wrong auth")
+	}
+
+	// Same key, new password, the transport of the old credentials must not be reused
+	resp, err := client.Get(plain.URL)
+	if err != nil {
+		t.Fatalf("failed to get through the proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("expected the upstream to reject the new password, got %v", resp.Status)
+	}
+}
+
+func TestSOCKS5Upstream(t *testing.T) {
+	_, secure := origins(t)
+
+	socks := startSOCKS5(t, "user", "pass")
+	upstream, err := ParseUpstream("socks5://user:pass@" + socks)
+	if err != nil {
+		t.Fatalf("failed to parse upstream: %v", err)
+	}
+
+	proxy := startProxy(t, func() (*Upstream, error) { return upstream, nil })
+
+	if body := get(t, proxy, secure.URL); body != "hello" {
+		t.Errorf("unexpected body: %v", body)
+	}
+}
+
+func TestSwapUpstream(t *testing.T) {
+	plain, _ := origins(t)
+
+	var mu sync.Mutex
+	var current *Upstream
+	inner := httptest.NewServer(New(NewOptions()))
+	defer inner.Close()
+
+	proxy := startProxy(t, func() (*Upstream, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return current, nil
+	})
+
+	get(t, proxy, plain.URL)
+
+	mu.Lock()
+	current, _ = ParseUpstream(inner.Listener.Addr().String())
+	mu.Unlock()
+
+	get(t, proxy, plain.URL)
+
+	traffic := proxy.Traffic()
+	if len(traffic) != 2 {
+		t.Errorf("expected traffic of both upstreams, got %v", traffic)
+	}
+
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	if _, ok := proxy.transports[current.Key()]; !ok || len(proxy.transports) != 1 {
+		t.Errorf("only the transport of the current upstream should be kept, got %v", len(proxy.transports))
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	plain, secure := origins(t)
+
+	proxy := New(NewOptions(WithCredentials("user", "secret")))
+	if err := proxy.Start(); err != nil {
+		t.Fatalf("failed to start proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(plain.URL)
+	if err != nil {
+		t.Fatalf("failed to get %v: %v", plain.URL, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("request without credentials was let through: %v", resp.Status)
+	}
+
+	if _, err := client.Get(secure.URL); err == nil {
+		t.Errorf("tunnel without credentials was let through")
+	}
+
+	proxyURL.User = url.UserPassword("user", "secret")
+	client = &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	for _, target := range []string{plain.URL, secure.URL} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("failed to get %v with credentials: %v", target, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request with credentials was refused: %v", resp.Status)
+		}
+	}
+}
+
+func TestParseUpstream(t *testing.T) {
+	upstream, err := ParseUpstream("socks5://a:b@127.0.0.1:1080")
+	if err != nil || upstream.URL.Host != "127.0.0.1:1080" || upstream.Username != "a" || upstream.Password != "b" {
+		t.Errorf("unexpected upstream: %+v, %v", upstream, err)
+	}
+	if upstream.Key() != "socks5://a@127.0.0.1:1080" {
+		t.Errorf("unexpected key: %v", upstream.Key())
+	}
+
+	if _, err := ParseUpstream("ftp://127.0.0.1:21"); err == nil {
+		t.Errorf("expected an error for an unsupported scheme")
+	}
+
+	var direct *Upstream
+	if direct.Key() != "direct" {
+		t.Errorf("nil upstream should be direct")
+	}
+}
+
+// startSOCKS5 serves the connect command of socks5 with username and password auth
+func startSOCKS5(t *testing.T, username, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, username, password)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveSOCKS5(conn net.Conn, username, password string) {
+	defer conn.Close()
+
+	buf := make([]byte, 512)
+	// Greeting, only username and password auth is offered back
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 2})
+
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	pass := make([]byte, buf[0])
+	io.ReadFull(conn, pass)
+
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	// Connect request
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
@@ -1,7 +1,9 @@
 package requestcontext
 
 import (
+	"fmt"
 	"log"
+	"strings"
 )
 
 type BDProxyAgent struct {
@@ -21,17 +23,43 @@ func NewBDProxyAgent(opts *BDProxyOptions) *BDProxyAgent {
 	}
 }
 
+// GetAuth adds the session to the username, every session id gets its own exit
 func (p *BDProxyAgent) GetAuth() (*ProxyAuth, error) {
-	return p.Auth, nil
+	if p.SessionID == 0 {
+		return p.Auth, nil
+	}
+
+	auth := *p.Auth
+	auth.Username = fmt.Sprintf("%v-session-%v", p.Auth.Username, p.SessionID)
+	return &auth, nil
 }
 
 func (p *BDProxyAgent) SetProxy() error {
 	p.SessionID++
-	// TODO: make username id increment on new proxy request
-	log.Println(p.Auth.Username)
+	log.Println(p.Auth.Username, p.SessionID)
 	return nil
 }
 
+func (p *BDProxyAgent) ProxyServer() string {
+	return fmt.Sprintf("http://%v", p.Auth.Server)
+}
+
 func (p *BDProxyAgent) LoadProxies() error {
 	return nil
 }
+
+// ProxyID changes with every SetProxy as each session id gets its own exit
+func (p *BDProxyAgent) ProxyID() string {
+	return fmt.Sprintf("%v-%v-%v", p.Auth.Server, p.Auth.Username, p.SessionID)
+}
+
+// ProxyCountry reads the country targeting of the zone, like brd-customer-c1-zone-z1-country-lt
+func (p *BDProxyAgent) ProxyCountry() string {
+	parts := strings.Split(p.Auth.Username, "-")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "country" {
+			return strings.ToUpper(parts[i+1])
+		}
+	}
+	return ""
+}
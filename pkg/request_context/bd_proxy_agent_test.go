@@ -0,0 +1,62 @@
+package requestcontext
+
+import "testing"
+
+func TestBDProxyAgentSession(t *testing.T) {
+	agent := NewBDProxyAgent(NewBDProxyOptions(
+		WithServer("brd.superproxy.io:22225"),
+		WithUsername("brd-customer-c1-zone-z1"),
+		WithPassword("secret"),
+	))
+
+	auth, _ := agent.GetAuth()
+	if auth.Username != "brd-customer-c1-zone-z1" {
+		t.Errorf("username changed before the first SetProxy: %v", auth.Username)
+	}
+
+	agent.SetProxy()
+	agent.SetProxy()
+
+	auth, _ = agent.GetAuth()
+	if auth.Username != "brd-customer-c1-zone-z1-session-2" || auth.Password != "secret" {
+		t.Errorf("unexpected auth: %+v", auth)
+	}
+	if agent.Auth.Username != "brd-customer-c1-zone-z1" {
+		t.Errorf("base username was modified: %v", agent.Auth.Username)
+	}
+
+	c := GetCDPContext(NewCDPOptions())
+	if len(c.browserContextOptions()) != 0 {
+		t.Errorf("expected no proxy without an agent")
+	}
+
+	c.RegisterProxyAgent(agent)
+	if c.proxyServer() != "http://brd.superproxy.io:22225" {
+		t.Errorf("unexpected proxy server: %v", c.proxyServer())
+	}
+	if len(c.browserContextOptions()) != 1 {
+		t.Errorf("expected the proxy server to be set on the browser context")
+	}
+}
+
+func TestBDProxyAgentCountry(t *testing.T) {
+	agent := NewBDProxyAgent(NewBDProxyOptions(WithUsername("brd-customer-c1-zone-z1-country-lt")))
+	if agent.ProxyCountry() != "LT" {
+		t.Errorf("unexpected country: %v", agent.ProxyCountry())
+	}
+
+	// The country follows the proxy, not the locale
+	c := GetCDPContext(NewCDPOptions(WithLocale("en-US")))
+	c.RegisterProxyAgent(agent)
+	if err := c.resolveProfile(); err != nil {
+		t.Fatalf("failed to resolve profile: %v", err)
+	}
+	if c.Profile().Timezone != "Europe/Vilnius" {
+		t.Errorf("timezone does not match the proxy: %v", c.Profile().Timezone)
+	}
+
+	agent = NewBDProxyAgent(NewBDProxyOptions(WithUsername("brd-customer-c1-zone-z1")))
+	if agent.ProxyCountry() != "" {
+		t.Errorf("zone without targeting should have no country: %v", agent.ProxyCountry())
+	}
+}
@@ -0,0 +1,136 @@
+package requestcontext
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+// BlockDetector inspects the page after a navigation, nil means the page was not blocked
+type BlockDetector interface {
+	Detect(page BlockPage) *perrors.Blocked
+}
+
+// BlockPage is what a detector gets to look at, Status and Headers are of the main document response
+type BlockPage struct {
+	URL     string
+	Status  int
+	Headers map[string]string
+	HTML    string
+}
+
+// BlockRule marks a page as blocked when all of its set conditions hold
+type BlockRule struct {
+	Name string
+	// URL limits the rule to a site, empty matches every page
+	URL    URLPattern
+	Status []int
+	// Marker is searched for in the html
+	Marker *regexp.Regexp
+	// Header is matched against the value of HeaderName
+	HeaderName string
+	Header     *regexp.Regexp
+	Action     int
+}
+
+func (r BlockRule) Match(page BlockPage) bool {
+	if r.URL.String() != "" && !r.URL.Match(page.URL) {
+		return false
+	}
+
+	if len(r.Status) > 0 && !containsStatus(r.Status, page.Status) {
+		return false
+	}
+
+	if r.Marker != nil && !r.Marker.MatchString(page.HTML) {
+		return false
+	}
+
+	if r.HeaderName != "" {
+		value := headerValue(page.Headers, r.HeaderName)
+		if value == "" || (r.Header != nil && !r.Header.MatchString(value)) {
+			return false
+		}
+	}
+
+	return len(r.Status) > 0 || r.Marker != nil || r.HeaderName != ""
+}
+
+// challengeStatuses are what the vendors answer a challenged request with, widgets on pages that were
+// served normally are not blocks
+var challengeStatuses = []int{http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+// ChallengeRules detect the challenge pages of the common anti bot vendors. Markers only match the
+// interstitial pages, the scripts the vendors add to regular pages are left alone.
+var ChallengeRules = []BlockRule{
+	{Name: "cloudflare", HeaderName: "cf-mitigated", Header: regexp.MustCompile(`(?i)challenge`), Action: perrors.BLOCKED_RETRY},
+	{Name: "cloudflare", Marker: regexp.MustCompile(`(?i)<title>Just a moment\.\.\.</title>|<title>Attention Required! \| Cloudflare</title>|window\._cf_chl_opt`), Action: perrors.BLOCKED_RETRY},
+	{Name: "cloudflare", Status: challengeStatuses, Marker: regexp.MustCompile(`(?i)/cdn-cgi/challenge-platform/`), Action: perrors.BLOCKED_RETRY},
+	{Name: "datadome", Marker: regexp.MustCompile(`(?i)//(geo|ct)\.captcha-delivery\.com/`), Action: perrors.BLOCKED_RETRY},
+	{Name: "datadome", HeaderName: "x-datadome", Status: []int{http.StatusForbidden}, Action: perrors.BLOCKED_RETRY},
+	{Name: "perimeterx", Marker: regexp.MustCompile(`(?i)id="px-captcha"|captcha\.px-cdn\.net`), Action: perrors.BLOCKED_RETRY},
+	{Name: "recaptcha", URL: URLPattern{Glob: "https://www.google.com/sorry/*"}, Marker: regexp.MustCompile(`(?i)id="captcha-form"`), Action: perrors.BLOCKED_RETRY},
+	{Name: "recaptcha", Status: challengeStatuses, Marker: regexp.MustCompile(`(?i)google\.com/recaptcha/|class="g-recaptcha"`), Action: perrors.BLOCKED_RETRY},
+	{Name: "hcaptcha", Status: challengeStatuses, Marker: regexp.MustCompile(`(?i)hcaptcha\.com/1/api\.js|class="h-captcha"`), Action: perrors.BLOCKED_RETRY},
+}
+
+// BlockedStatuses are main document statuses treated as blocks
+var BlockedStatuses = []int{http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+// DefaultBlockDetector checks the custom rules first, then the known challenge markers and the status
+type DefaultBlockDetector struct {
+	Rules          []BlockRule
+	ChallengeRules []BlockRule
+	Statuses       []int
+}
+
+func NewBlockDetector(rules ...BlockRule) *DefaultBlockDetector {
+	return &DefaultBlockDetector{
+		Rules:          rules,
+		ChallengeRules: ChallengeRules,
+		Statuses:       BlockedStatuses,
+	}
+}
+
+func (d *DefaultBlockDetector) Detect(page BlockPage) *perrors.Blocked {
+	for _, rules := range [][]BlockRule{d.Rules, d.ChallengeRules} {
+		for _, rule := range rules {
+			if rule.Match(page) {
+				return blocked(page, fmt.Sprintf("matched %v rule", rule.Name), rule.Action)
+			}
+		}
+	}
+
+	if containsStatus(d.Statuses, page.Status) {
+		return blocked(page, fmt.Sprintf("main document returned %v", page.Status), perrors.BLOCKED_RETRY)
+	}
+
+	return nil
+}
+
+func blocked(page BlockPage, reason string, action int) *perrors.Blocked {
+	site := page.URL
+	if u, err := url.Parse(page.URL); err == nil && u.Host != "" {
+		site = strings.ToLower(u.Host)
+	}
+
+	return &perrors.Blocked{
+		SiteId: site,
+		Reason: reason,
+		Status: page.Status,
+		Action: action,
+	}
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package requestcontext
+
+import (
+	"regexp"
+	"testing"
+
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+func TestBlockDetector(t *testing.T) {
+	detector := NewBlockDetector(BlockRule{
+		Name:   "shop",
+		URL:    URLPattern{Glob: "https://shop.example.com/*"},
+		Marker: regexp.MustCompile(`Access denied`),
+		Action: perrors.BLOCKED_TERMINATE,
+	})
+
+	cases := []struct {
+		name   string
+		page   BlockPage
+		reason string
+		action int
+	}{
+		{
+			name: "ok page",
+			page: BlockPage{URL: "https://example.com/", Status: 200, HTML: "<html><body>items</body></html>"},
+		},
+		{
+			name:   "custom rule",
+			page:   BlockPage{URL: "https://shop.example.com/list", Status: 200, HTML: "<h1>Access denied</h1>"},
+			reason: "matched shop rule",
+			action: perrors.BLOCKED_TERMINATE,
+		},
+		{
+			name: "custom rule on another site",
+			page: BlockPage{URL: "https://example.com/list", Status: 200, HTML: "<h1>Access denied</h1>"},
+		},
+		{
+			name:   "cloudflare header",
+			page:   BlockPage{URL: "https://example.com/", Status: 403, Headers: map[string]string{"Cf-Mitigated": "challenge"}},
+			reason: "matched cloudflare rule",
+			action: perrors.BLOCKED_RETRY,
+		},
+		{
+			name:   "cloudflare marker",
+			page:   BlockPage{URL: "https://example.com/", Status: 200, HTML: "<title>Just a moment...</title>"},
+			reason: "matched cloudflare rule",
+			action: perrors.BLOCKED_RETRY,
+		},
+		{
+			name:   "hcaptcha marker",
+			page:   BlockPage{URL: "https://example.com/", Status: 403, HTML: `<div class="h-captcha" data-sitekey="x"></div>`},
+			reason: "matched hcaptcha rule",
+			action: perrors.BLOCKED_RETRY,
+		},
+		{
+			name: "form with recaptcha",
+			page: BlockPage{URL: "https://example.com/contact", Status: 200, HTML: `<script src="https://www.google.com/recaptcha/api.js"></script><div class="g-recaptcha" data-sitekey="x"></div>`},
+		},
+		{
+			name: "form with hcaptcha",
+			page: BlockPage{URL: "https://example.com/login", Status: 200, HTML: `<script src="https://js.hcaptcha.com/1/api.js"></script><div class="h-captcha"></div>`},
+		},
+		{
+			name: "page with vendor scripts",
+			page: BlockPage{URL: "https://example.com/", Status: 200, HTML: `<script src="/static/add.js"></script><script src="/cdn-cgi/challenge-platform/scripts/jsd/main.js"></script><script src="/_px/init.js"></script><script src="https://js.datadome.co/tags.js"></script>`},
+		},
+		{
+			name:   "datadome interstitial",
+			page:   BlockPage{URL: "https://example.com/", Status: 403, HTML: `<iframe src="https://geo.captcha-delivery.com/captcha/?initialCid=x"></iframe>`},
+			reason: "matched datadome rule",
+			action: perrors.BLOCKED_RETRY,
+		},
+		{
+			name:   "recaptcha on a blocked page",
+			page:   BlockPage{URL: "https://example.com/", Status: 429, HTML: `<div class="g-recaptcha"></div>`},
+			reason: "matched recaptcha rule",
+			action: perrors.BLOCKED_RETRY,
+		},
+		{
+			name:   "rate limited",
+			page:   BlockPage{URL: "https://example.com/", Status: 429},
+			reason: "main document returned 429",
+			action: perrors.BLOCKED_RETRY,
+		},
+	}
+
+	for _, c := range cases {
+		blocked := detector.Detect(c.page)
+
+		if c.reason == "" {
+			if blocked != nil {
+				t.Errorf("%v: unexpected block: %+v", c.name, blocked)
+			}
+			continue
+		}
+
+		if blocked == nil {
+			t.Errorf("%v: block was not detected", c.name)
+			continue
+		}
+
+		if blocked.Reason != c.reason || blocked.Action != c.action || blocked.Status != c.page.Status {
+			t.Errorf("%v: unexpected block: %+v", c.name, blocked)
+		}
+
+		if blocked.SiteId == "" {
+			t.Errorf("%v: site was not set", c.name)
+		}
+	}
+}
+
+func TestBlockRulesOptionOrder(t *testing.T) {
+	first := BlockRule{Name: "first", Marker: regexp.MustCompile(`first`), Action: perrors.BLOCKED_TERMINATE}
+	second := BlockRule{Name: "second", Marker: regexp.MustCompile(`second`), Action: perrors.BLOCKED_TERMINATE}
+
+	shared := NewBlockDetector(first)
+	opts := NewCDPOptions(WithBlockDetector(shared), WithBlockRules(second))
+
+	for _, html := range []string{"first", "second", "<title>Just a moment...</title>"} {
+		if opts.BlockDetector.Detect(BlockPage{URL: "https://example.com/", Status: 200, HTML: html}) == nil {
+			t.Errorf("rule for %q was dropped", html)
+		}
+	}
+
+	if len(shared.Rules) != 1 {
+		t.Errorf("detector passed to the options was changed, has %v rules", len(shared.Rules))
+	}
+
+	opts = NewCDPOptions(WithBlockRules(first), WithBlockRules(second))
+	detector, ok := opts.BlockDetector.(*DefaultBlockDetector)
+	if !ok || len(detector.Rules) != 2 || len(detector.ChallengeRules) == 0 {
+		t.Errorf("rules were not added to the default detector: %+v", opts.BlockDetector)
+	}
+
+	opts = NewCDPOptions(WithBlockDetector(nil), WithBlockRules(second))
+	if opts.BlockDetector == nil || opts.BlockDetector.Detect(BlockPage{URL: "https://example.com/", Status: 200, HTML: "second"}) == nil {
+		t.Errorf("rules after a disabled detector were not applied")
+	}
+}
@@ -2,22 +2,27 @@ package requestcontext
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/dom"
 	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/fetch"
 	"github.com/chromedp/cdproto/network"
-	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/target"
 	"github.com/chromedp/chromedp"
+	forwardproxy "github.com/dovydasdo/psec/pkg/forward_proxy"
 	util "github.com/dovydasdo/psec/util/injections"
 )
 
@@ -27,15 +32,74 @@ type CDPContext struct {
 
 	allocator       context.Context
 	allocatorCancel context.CancelFunc
-
-	binPath       string
-	injectionPath string
-	logger        *slog.Logger
+	// browser is the root of the sessions, ctx runs in a browser context of its own
+	browser       context.Context
+	browserCancel context.CancelFunc
+
+	binPath        string
+	injectionPath  string
+	stealthModules []string
+	scripts        []Script
+	remoteURL      string
+	remoteToken    string
+	emulation      Emulation
+	timeout        time.Duration
+	registry       *Registry
+	logger         *slog.Logger
 
 	State      *State
 	ProxyAgent ProxyGetter
+
+	responses *responseHub
+
+	rulesMu          sync.RWMutex
+	rules            []InterceptRule
+	instructionRules []InterceptRule
+
+	blockDetector BlockDetector
+	documentMu    sync.Mutex
+	document      *NetworkEvent
+
+	sessionStore SessionStore
+	sessionSite  string
+	sessionKey   string
+
+	emulatorData    util.Source
+	osProfiles      []util.OSProfile
+	browserVersion  int
+	versionMatch    int
+	detectedVersion int
+	profile         *FingerprintProfile
+	fixedProfile    *FingerprintProfile
+	profileStore    ProfileStore
+	profileKey      string
+	rotateProfile   bool
+
+	tabsMu sync.Mutex
+	tabs   map[target.ID]*Tab
+	popups chan *Tab
+
+	// owner is the context a tab was opened from, nil for the main page
+	owner       *CDPContext
+	navigations int64
+	redirects   int64
+
+	exitIPURL    string
+	exitIP       string
+	proxyChanged bool
+
+	forwardProxy bool
+	forwarder    *forwardproxy.Proxy
+	forwardAuth  *ProxyAuth
+	upstreamMu   sync.Mutex
+	upstream     *forwardproxy.Upstream
 }
 
+const (
+	defaultInstructionTimeout = 30 * time.Second
+	browserPingTimeout        = 5 * time.Second
+)
+
 type Result struct {
 	Name     string
 	Duration time.Duration
@@ -45,41 +109,233 @@ type Result struct {
 }
 
 func GetCDPContext(options *CDPOptions) *CDPContext {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultInstructionTimeout
+	}
+
+	registry := options.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	emulatorData := options.EmulatorData
+	if emulatorData == nil {
+		emulatorData = util.DefaultSource
+	}
+
+	osProfiles := options.OSProfiles
+	if len(osProfiles) == 0 {
+		osProfiles = util.OSProfiles
+	}
+
 	return &CDPContext{
-		State:         &State{},
-		logger:        options.Logger,
-		binPath:       options.BinPath,
-		injectionPath: options.InjectionPath,
+		State:          &State{},
+		responses:      newResponseHub(),
+		logger:         logger,
+		registry:       registry,
+		binPath:        options.BinPath,
+		injectionPath:  options.InjectionPath,
+		stealthModules: options.StealthModules,
+		scripts:        options.Scripts,
+		remoteURL:      options.RemoteURL,
+		remoteToken:    options.RemoteToken,
+		emulation:      options.Emulation,
+		fixedProfile:   options.Profile,
+		emulatorData:   emulatorData,
+		osProfiles:     osProfiles,
+		browserVersion: options.BrowserVersion,
+		versionMatch:   options.VersionMatch,
+		profileStore:   options.ProfileStore,
+		timeout:        timeout,
+		rules:          options.InterceptRules,
+		blockDetector:  options.BlockDetector,
+		sessionStore:   options.SessionStore,
+		sessionSite:    options.SessionSite,
+		exitIPURL:      options.ExitIPURL,
+		forwardProxy:   options.ForwardProxy,
 	}
 }
 
+// Initialize starts a session in a new browser context, the browser is launched first if it is not running.
+// Every session gets its own cookie jar and the proxy server the agent currently reports.
 func (c *CDPContext) Initialize() error {
-	// if proxy agent has been registered set the proxy
-	opts := chromedp.DefaultExecAllocatorOptions[:]
-	opts = append(opts, chromedp.Flag("ignore-certificate-errors", true))
-
-	if bdAgent, ok := c.ProxyAgent.(*BDProxyAgent); ok {
-		opts = append(opts, chromedp.ProxyServer(fmt.Sprintf("http://%v", bdAgent.Auth.Server)))
+	if !c.browserRunning() {
+		if err := c.launch(); err != nil {
+			return err
+		}
 	}
 
-	opts = append(opts, chromedp.ExecPath(c.binPath))
-
-	allocatorContext, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	if err := c.RefreshUpstream(); err != nil {
+		return err
+	}
 
-	cdpCtx, cf := chromedp.NewContext(allocatorContext)
+	cdpCtx, cf := chromedp.NewContext(c.browser, chromedp.WithNewBrowserContext(c.browserContextOptions()...))
 
 	c.cancel = cf
 	c.ctx = cdpCtx
+	c.tabs = make(map[target.ID]*Tab)
+	c.popups = make(chan *Tab, popupBuffer)
+
+	err := c.resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	err = c.attach()
+	if err != nil {
+		return err
+	}
+
+	err = chromedp.Run(c.ctx, chromedp.Navigate("about:blank"))
+	if err != nil {
+		return err
+	}
+
+	c.listenPopups()
+
+	if c.sessionStore != nil {
+		if err := c.RestoreSession(); err != nil {
+			c.logger.Warn("cdp", "message", "failed to restore session", "key", c.sessionKey, "error", err)
+		}
+	}
+
+	if c.exitIPURL != "" {
+		if err := c.verifyExitIP(); err != nil {
+			return err
+		}
+	}
+	c.proxyChanged = false
+
+	return nil
+}
+
+// launch starts the browser, or connects to the remote one, and keeps its first target as the root of the sessions
+func (c *CDPContext) launch() error {
+	c.closeBrowser()
+
+	if err := c.startForwarder(); err != nil {
+		return err
+	}
+
+	allocatorContext, cancel := c.newAllocator()
+	browserCtx, browserCancel := chromedp.NewContext(allocatorContext)
+
 	c.allocator = allocatorContext
 	c.allocatorCancel = cancel
+	c.browser = browserCtx
+	c.browserCancel = browserCancel
+
+	if err := chromedp.Run(browserCtx); err != nil {
+		c.closeBrowser()
+		return err
+	}
+
+	if c.versionMatch != VERSION_MATCH_OFF {
+		if err := c.detectBrowserVersion(); err != nil {
+			c.closeBrowser()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// browserRunning checks that the browser still answers, a crashed one is launched again by Initialize
+func (c *CDPContext) browserRunning() bool {
+	if c.browser == nil || c.browser.Err() != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(c.browser, browserPingTimeout)
+	defer cancel()
+
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, _, _, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Browser))
+		return err
+	}))
+	if err != nil {
+		c.logger.Warn("cdp", "message", "browser is not responding, relaunching", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// browserContextOptions set the proxy of the session: the forwarding proxy, or the server of the agent.
+// Agents that do not report a server leave the browser on its own proxy settings.
+func (c *CDPContext) browserContextOptions() []chromedp.CreateBrowserContextOption {
+	server := c.proxyServer()
+	if server == "" {
+		return nil
+	}
+
+	c.logger.Debug("cdp", "message", "using proxy server", "server", server)
+
+	return []chromedp.CreateBrowserContextOption{
+		func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+			return p.WithProxyServer(server)
+		},
+	}
+}
+
+func (c *CDPContext) proxyServer() string {
+	if c.forwarder != nil {
+		return c.forwarder.URL()
+	}
+	if endpoint, ok := c.ProxyAgent.(ProxyEndpoint); ok {
+		return endpoint.ProxyServer()
+	}
+	return ""
+}
+
+func (c *CDPContext) closeBrowser() {
+	if c.browserCancel != nil {
+		c.browserCancel()
+	}
+	if c.allocatorCancel != nil {
+		c.allocatorCancel()
+	}
+
+	if c.forwarder != nil {
+		c.forwarder.Close()
+	}
+
+	c.browser, c.browserCancel = nil, nil
+	c.allocator, c.allocatorCancel = nil, nil
+	c.forwarder, c.forwardAuth = nil, nil
+}
+
+// newAllocator launches the local binary, or connects to the running browser if a remote url is set
+func (c *CDPContext) newAllocator() (context.Context, context.CancelFunc) {
+	if c.remoteURL != "" {
+		return c.newRemoteAllocator()
+	}
+
+	// The proxy is set per session, see browserContextOptions
+	opts := chromedp.DefaultExecAllocatorOptions[:]
+	opts = append(opts, chromedp.Flag("ignore-certificate-errors", true))
+
+	opts = append(opts, c.emulation.allocatorOptions()...)
+	opts = append(opts, chromedp.ExecPath(c.binPath))
+
+	return chromedp.NewExecAllocator(context.Background(), opts...)
+}
 
+// attach sets up capture, interception and the fingerprint overrides on the target of c.ctx
+func (c *CDPContext) attach() error {
 	// Capture network traffic and save to internal state
 	chromedp.ListenTarget(c.ctx, func(ev interface{}) {
 		switch ev := ev.(type) {
 		case *fetch.EventAuthRequired:
 			if ev.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
 				go func() {
-					auth, err := c.ProxyAgent.GetAuth()
+					auth, err := c.proxyAuth()
 					if err != nil {
 						log.Fatal(err)
 					}
@@ -95,26 +351,51 @@ func (c *CDPContext) Initialize() error {
 			}
 		case *network.EventResponseReceived:
 			if event, ok := c.State.NetworkEvents.Load(ev.RequestID); ok {
+				if e, ok := event.(*NetworkEvent); ok {
+					setResponse(e, ev.Response)
+
+					if ev.Type == network.ResourceTypeDocument && c.isMainFrame(ev.FrameID) {
+						c.setDocument(e)
+					}
+				}
+			}
+
+		case *network.EventRequestServedFromCache:
+			if event, ok := c.State.NetworkEvents.Load(ev.RequestID); ok {
+				if e, ok := event.(*NetworkEvent); ok {
+					e.Response.FromCache = true
+				}
+			}
+
+		case *network.EventLoadingFinished:
+			// The body is only guaranteed to be available once loading has finished
+			if event, ok := c.State.NetworkEvents.Load(ev.RequestID); ok {
+				e, ok := event.(*NetworkEvent)
+				if !ok {
+					return
+				}
+
+				e.Response.EncodedDataLength = int64(ev.EncodedDataLength)
+				if ev.Timestamp != nil && e.Timing.RequestTime > 0 {
+					finished := float64(ev.Timestamp.Time().UnixNano()) / float64(time.Second)
+					e.Timing.LoadingFinished = (finished - e.Timing.RequestTime) * 1000
+				}
 
-				resp := NetworkResponse{}
 				go func() {
-					c.logger.Debug("cdp", "getting body for url", ev.Response.URL)
+					c.logger.Debug("cdp", "getting body for url", e.Response.URL)
 
 					err := chromedp.Run(c.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
-						body, err := network.GetResponseBody(ev.RequestID).Do(ctx)
-						resp.Body = string(body)
+						body, encoded, err := getResponseBody(ctx, ev.RequestID)
+						e.Response.Body = body
+						e.Response.Base64Encoded = encoded
 						return err
 					}))
 
-					resp.URL = ev.Response.URL
-
 					if err != nil {
-						time.Sleep(time.Second)
+						c.logger.Debug("cdp", "failed to get body for url", e.Response.URL, "error", err)
 					}
 
-					if e, ok := event.(*NetworkEvent); ok {
-						e.Response = resp
-					}
+					c.responses.publish(ev.RequestID)
 				}()
 			}
 
@@ -123,7 +404,24 @@ func (c *CDPContext) Initialize() error {
 			req := NetworkRequest{}
 			req.Body = ev.Request.PostData
 			req.URL = ev.Request.URL
+			req.Method = ev.Request.Method
+			req.Type = string(ev.Type)
 			req.Headers = GetHeaders(ev.Request.Headers)
+			req.Time = time.Now()
+			if ev.WallTime != nil {
+				req.Time = ev.WallTime.Time()
+			}
+
+			// Hops of a redirect share the id, the previous one gets its response and a key of its own
+			if ev.RedirectResponse != nil {
+				if event, ok := c.State.NetworkEvents.LoadAndDelete(ev.RequestID); ok {
+					if e, ok := event.(*NetworkEvent); ok {
+						setResponse(e, ev.RedirectResponse)
+						hop := atomic.AddInt64(&c.redirects, 1)
+						c.State.NetworkEvents.Store(network.RequestID(fmt.Sprintf("%v-redirect-%v", ev.RequestID, hop)), e)
+					}
+				}
+			}
 
 			c.State.NetworkEvents.Store(ev.RequestID, &NetworkEvent{Request: req})
 
@@ -160,6 +458,22 @@ func (c *CDPContext) Initialize() error {
 				return
 			}
 
+			// Apply the first matching interception rule
+			if rule, ok := c.matchInterceptRule(ev); ok {
+				go func() {
+					err := chromedp.Run(c.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+						return applyInterceptRule(ctx, ev, rule)
+					}))
+
+					c.logger.Debug("cdp", "intercept rule applied for url", ev.Request.URL, "action", rule.Action)
+
+					if err != nil {
+						log.Println(err.Error())
+					}
+				}()
+				return
+			}
+
 			// Let request pass
 			go func() {
 				err := chromedp.Run(c.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
@@ -177,59 +491,31 @@ func (c *CDPContext) Initialize() error {
 		}
 	})
 
-	injection, err := GetInjection(c.injectionPath)
+	// Tabs reuse the profile of the browser
+	if c.profile == nil {
+		if err := c.resolveProfile(); err != nil {
+			return err
+		}
+	}
+
+	overrideUA := c.profile.userAgentOverride()
+	if c.emulation.Locale != "" {
+		overrideUA.AcceptLanguage = c.emulation.Locale
+	}
+	injections, err := c.injections()
 	if err != nil {
-		c.logger.Error("cdp", "failed to read injection, aborting. Err: %v", err.Error())
+		c.logger.Error("cdp", "message", "failed to prepare injections", "error", err)
 		return err
 	}
 
-	addInjection := page.AddScriptToEvaluateOnNewDocument(injection)
-	addInjection.RunImmediately = true
+	emulate := c.emulation
+	if emulate.Device == nil {
+		emulate.Device = c.profile.device()
+	}
 
-	uaInfo, err := util.GetLatestUAInfo()
-	if err != nil {
-		c.logger.Warn("cdp", "message", "failed to get latest user agent data, static data will be used")
-	}
-
-	overrideUA := emulation.SetUserAgentOverride(uaInfo.UserAgent)
-	overrideUA.AcceptLanguage = uaInfo.AcceptLanguage
-	overrideUA.Platform = uaInfo.Platform
-	overrideUA.UserAgentMetadata = &emulation.UserAgentMetadata{
-		Architecture:    uaInfo.Metadata.JsHighEntropyHints.Architecture,
-		Bitness:         uaInfo.Metadata.JsHighEntropyHints.Bitness,
-		Mobile:          uaInfo.Metadata.JsHighEntropyHints.Mobile,
-		Model:           uaInfo.Metadata.JsHighEntropyHints.Model,
-		Platform:        uaInfo.Metadata.JsHighEntropyHints.Platform,
-		PlatformVersion: uaInfo.Metadata.JsHighEntropyHints.PlatformVersion,
-		Wow64:           uaInfo.Metadata.JsHighEntropyHints.Wow64,
-		Brands: []*emulation.UserAgentBrandVersion{
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.Brands[0].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.Brands[0].Version,
-			},
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.Brands[1].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.Brands[1].Version,
-			},
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.Brands[2].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.Brands[2].Version,
-			},
-		},
-		FullVersionList: []*emulation.UserAgentBrandVersion{
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.FullVersionList[0].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.FullVersionList[0].Version,
-			},
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.FullVersionList[1].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.FullVersionList[1].Version,
-			},
-			{
-				Brand:   uaInfo.Metadata.JsHighEntropyHints.FullVersionList[2].Brand,
-				Version: uaInfo.Metadata.JsHighEntropyHints.FullVersionList[2].Version,
-			},
-		},
+	emulationActions := emulate.actions()
+	if c.profile.Timezone != "" && c.emulation.Timezone == "" {
+		emulationActions = append(emulationActions, emulation.SetTimezoneOverride(c.profile.Timezone))
 	}
 
 	overrideAutomation := emulation.SetAutomationOverride(false)
@@ -238,13 +524,14 @@ func (c *CDPContext) Initialize() error {
 		network.Enable(),
 		fetch.Enable().WithHandleAuthRequests(true),
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			// Fingerprint stuff
-			_, err := addInjection.Do(ctx)
-			if err != nil {
-				return err
+			// Fingerprint stuff, the stealth scripts have to run before the profile overrides
+			for _, injection := range injections {
+				if _, err := injection.Do(ctx); err != nil {
+					return err
+				}
 			}
 
-			err = overrideUA.Do(ctx)
+			err := overrideUA.Do(ctx)
 			if err != nil {
 				return err
 			}
@@ -254,96 +541,208 @@ func (c *CDPContext) Initialize() error {
 				return err
 			}
 
-			return err
+			for _, action := range emulationActions {
+				if err := action.Do(ctx); err != nil {
+					return err
+				}
+			}
+
+			return nil
 		}),
-		chromedp.Navigate("about:blank"))
+	)
 }
 
+// Reset saves the session and starts a clean one. The browser keeps running, the new session picks up
+// the proxy set by ChangeProxy through its own browser context.
 func (c *CDPContext) Reset() {
-	c.cancel()
-
-	cdpCtx, cf := chromedp.NewContext(c.allocator)
+	c.saveSession()
+	if c.cancel != nil {
+		c.cancel()
+	}
 
 	c.State = &State{}
-	c.ctx = cdpCtx
-	c.cancel = cf
-	c.Initialize()
+	err := c.Initialize()
+	for attempt := 0; errors.Is(err, ErrExitIPUnchanged) && attempt < exitIPRetries; attempt++ {
+		c.logger.Warn("cdp", "message", "exit ip did not change, switching proxy again", "error", err)
+		c.cancel()
+		c.State = &State{}
+
+		if err = c.ChangeProxy(); err != nil {
+			break
+		}
+		err = c.Initialize()
+	}
+
+	if err != nil {
+		c.logger.Error("cdp", "message", "failed to reset", "error", err)
+	}
 }
 
 func (c *CDPContext) Close() {
+	if c.cancel == nil {
+		return
+	}
+
+	c.saveSession()
 	c.cancel()
+	c.closeBrowser()
+}
+
+// Ping checks that the page still evaluates scripts
+func (c *CDPContext) Ping(timeout time.Duration) error {
+	if c.ctx == nil {
+		return errors.New("context is not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
+	var res int
+	return chromedp.Run(ctx, chromedp.Evaluate(`1`, &res))
+}
+
+// Navigations is the number of navigations since the browser was started, tabs included
+func (c *CDPContext) Navigations() int64 {
+	return atomic.LoadInt64(&c.root().navigations)
 }
 
-func (c *CDPContext) Do(ins ...interface{}) ([]Result, error) {
-	result := make([]Result, 0)
+func (c *CDPContext) countNavigation() {
+	atomic.AddInt64(&c.root().navigations, 1)
+}
+
+// saveSession saves the session if a store is configured, failures only get logged as the browser is going away
+func (c *CDPContext) saveSession() {
+	if c.sessionStore == nil || c.ctx == nil {
+		return
+	}
+
+	if err := c.SaveSession(); err != nil {
+		c.logger.Warn("cdp", "message", "failed to save session", "key", c.sessionKey, "error", err)
+	}
+}
 
+func (c *CDPContext) Do(ins ...Instruction) ([]Result, error) {
 	doStart := time.Now()
 
-	for _, instruction := range ins {
-		insStart := time.Now()
-		switch v := instruction.(type) {
-		case NavigateInstruction:
-			url := v.URL
-			done, err := c.GetDoneAction(v.DoneCondition)
-			if err != nil {
-				continue
-			}
+	exec := c.executor()
+	result, err := exec.run(ins...)
+	if err != nil {
+		return result, err
+	}
 
-			err = chromedp.Run(c.ctx,
-				network.SetBlockedURLS(v.Filters),
-				chromedp.Navigate(url),
-				done,
-				network.SetBlockedURLS(make([]string, 0)),
-			)
-
-			res := Result{
-				Type:     "navigate",
-				Duration: time.Now().Sub(insStart),
-				Error:    err,
-			}
+	// Todo: consider of some more fancy return types are neede
+	var html string
+	res := Result{Type: "html"}
+	err = exec.execute(0, &res, func(ctx context.Context) error {
+		return chromedp.Run(ctx,
+			chromedp.Evaluate(`document.documentElement.outerHTML`, &html),
+		)
+	})
 
-			c.logger.Debug("cdp.do", "result", res.Type)
+	res.Value = html
+	res.Duration = time.Now().Sub(doStart)
+	result = append(result, res)
+	return result, err
+}
 
-			result = append(result, res)
+func (c *CDPContext) executor() executor {
+	return executor{
+		ctx:      c.ctx,
+		loader:   c,
+		registry: c.registry,
+		timeout:  c.timeout,
+		logger:   c.logger,
+	}
+}
 
-			if err != nil {
-				return result, err
-			}
-		case JSEvalInstruction:
-			script := v.Script
-			_ = v.Timeout // not used for now
-			res := Result{
-				Type:     "js_eval",
-				Duration: time.Now().Sub(insStart),
-			}
+func (c *CDPContext) navigate(ctx context.Context, ins NavigateInstruction) error {
+	defer c.withInstructionRules(ins.Rules)()
 
-			err := chromedp.Run(c.ctx,
-				runtime.Enable(),
-				chromedp.Evaluate(script, v.Result),
-			)
+	filters := ins.Filters
+	if filters == nil {
+		filters = make([]string, 0)
+	}
 
-			// this is stupid
-			res.Value = v.Result
+	actions := []chromedp.Action{
+		network.SetBlockedURLS(filters),
+		chromedp.Navigate(ins.URL),
+	}
 
-			res.Error = err
-			result = append(result, res)
-		case string:
-			log.Println(v)
-			continue
-		default:
-			log.Println("Instruction type not recognised, skipping")
-			continue
+	if ins.DoneCondition != nil {
+		done, release, err := c.GetDoneAction(ins.DoneCondition)
+		if err != nil {
+			return err
 		}
+		defer release()
+		actions = append(actions, done)
 	}
 
-	// Todo: consider of some more fancy return types are neede
-	var html string
-	err := chromedp.Run(c.ctx,
-		chromedp.Evaluate(`document.documentElement.outerHTML`, &html),
+	// Filters are cleared on the loader context so that it happens even if the deadline was hit
+	defer chromedp.Run(c.ctx, network.SetBlockedURLS(make([]string, 0)))
+
+	c.setDocument(nil)
+	c.countNavigation()
+
+	err := chromedp.Run(ctx, actions...)
+	if err != nil {
+		return err
+	}
+
+	return c.detectBlock(ctx)
+}
+
+// detectBlock runs the block detector against the current page and its main document response
+func (c *CDPContext) detectBlock(ctx context.Context) error {
+	if c.blockDetector == nil {
+		return nil
+	}
+
+	page := BlockPage{}
+	err := chromedp.Run(ctx,
+		chromedp.Location(&page.URL),
+		chromedp.Evaluate(`document.documentElement.outerHTML`, &page.HTML),
 	)
+	if err != nil {
+		return err
+	}
 
-	result = append(result, Result{Type: "html", Value: html, Duration: time.Now().Sub(doStart)})
-	return result, err
+	c.documentMu.Lock()
+	if c.document != nil {
+		page.Status = c.document.Response.Status
+		page.Headers = c.document.Response.Headers
+	}
+	c.documentMu.Unlock()
+
+	if blocked := c.blockDetector.Detect(page); blocked != nil {
+		c.logger.Info("cdp", "message", "block detected", "site", blocked.SiteId, "reason", blocked.Reason, "status", blocked.Status)
+		return *blocked
+	}
+
+	return nil
+}
+
+func (c *CDPContext) setDocument(ev *NetworkEvent) {
+	c.documentMu.Lock()
+	defer c.documentMu.Unlock()
+
+	c.document = ev
+}
+
+// isMainFrame reports if the frame is the top level one, its id matches the id of the target
+func (c *CDPContext) isMainFrame(id cdp.FrameID) bool {
+	cdpCtx := chromedp.FromContext(c.ctx)
+	if cdpCtx == nil || cdpCtx.Target == nil {
+		return false
+	}
+
+	return string(cdpCtx.Target.TargetID) == string(id)
+}
+
+func (c *CDPContext) evaluate(ctx context.Context, ins JSEvalInstruction) error {
+	return chromedp.Run(ctx,
+		runtime.Enable(),
+		chromedp.Evaluate(ins.Script, ins.Result),
+	)
 }
 
 func (c *CDPContext) Cancel() {
@@ -376,51 +775,21 @@ func (c *CDPContext) RegisterProxyAgent(a ProxyGetter) {
 	c.ProxyAgent = a
 }
 
+// ChangeProxy switches the proxy, the next Initialize or Reset also switches the fingerprint profile
 func (c *CDPContext) ChangeProxy() error {
-	return c.ProxyAgent.SetProxy()
-}
-
-func (c CDPContext) GetDoneAction(condition interface{}) (chromedp.Action, error) {
-	switch cond := condition.(type) {
-	case DoneElVisible:
-		return chromedp.WaitVisible(cond), nil
-	case DoneResponseReceived:
-		return chromedp.ActionFunc(func(ctx context.Context) error {
-			//TODO: implement without polling
-			toBreak := false
-			cURL, err := url.Parse(string(cond))
-			if err != nil {
-				return nil
-			}
-			for i := 0; i < 20; i++ {
-				c.State.NetworkEvents.Range(func(key, value any) bool {
-					if v, ok := value.(*NetworkEvent); ok {
-						vURL, err := url.Parse(v.Response.URL)
-						if err != nil {
-							return true
-						}
-
-						if normalizeURL(vURL) == normalizeURL(cURL) {
-							toBreak = true
-							return true
-						}
-					}
-
-					return true
-				})
-
-				if toBreak {
-					break
-				}
+	err := c.ProxyAgent.SetProxy()
+	if err != nil {
+		return err
+	}
 
-				time.Sleep(time.Millisecond * 500)
-			}
+	c.rotateProfile = true
+	c.proxyChanged = true
+	return nil
+}
 
-			return nil
-		}), nil
-	default:
-		return nil, errors.New("the provided condition was not recognised")
-	}
+// Profile returns the fingerprint profile the browser runs with
+func (c *CDPContext) Profile() *FingerprintProfile {
+	return c.profile
 }
 
 func GetHeaders(protoHeaders network.Headers) map[string]string {
@@ -435,6 +804,64 @@ func GetHeaders(protoHeaders network.Headers) map[string]string {
 	return hto
 }
 
+// getResponseBody is network.GetResponseBody that also reports if the body was sent base64 encoded
+func getResponseBody(ctx context.Context, id network.RequestID) ([]byte, bool, error) {
+	var res network.GetResponseBodyReturns
+	err := cdp.Execute(ctx, network.CommandGetResponseBody, network.GetResponseBody(id), &res)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !res.Base64encoded {
+		return []byte(res.Body), false, nil
+	}
+
+	body, err := base64.StdEncoding.DecodeString(res.Body)
+	return body, true, err
+}
+
+// setResponse copies the response the browser reported into the event
+func setResponse(e *NetworkEvent, resp *network.Response) {
+	e.Response.URL = resp.URL
+	e.Response.Status = int(resp.Status)
+	e.Response.StatusText = resp.StatusText
+	e.Response.MimeType = resp.MimeType
+	e.Response.Headers = GetHeaders(resp.Headers)
+	e.Response.ContentType = headerValue(e.Response.Headers, "Content-Type")
+	e.Response.RemoteIP = resp.RemoteIPAddress
+	e.Response.RemotePort = int(resp.RemotePort)
+	e.Response.Protocol = resp.Protocol
+	e.Response.FromCache = e.Response.FromCache || resp.FromDiskCache || resp.FromPrefetchCache
+	e.Response.EncodedDataLength = int64(resp.EncodedDataLength)
+	e.Response.Time = time.Now()
+
+	if resp.Timing != nil {
+		e.Timing = GetTiming(resp.Timing)
+	}
+}
+
+func GetTiming(timing *network.ResourceTiming) NetworkTiming {
+	return NetworkTiming{
+		RequestTime:         timing.RequestTime,
+		ProxyStart:          timing.ProxyStart,
+		ProxyEnd:            timing.ProxyEnd,
+		DNSStart:            timing.DNSStart,
+		DNSEnd:              timing.DNSEnd,
+		ConnectStart:        timing.ConnectStart,
+		ConnectEnd:          timing.ConnectEnd,
+		SSLStart:            timing.SslStart,
+		SSLEnd:              timing.SslEnd,
+		WorkerStart:         timing.WorkerStart,
+		WorkerReady:         timing.WorkerReady,
+		SendStart:           timing.SendStart,
+		SendEnd:             timing.SendEnd,
+		PushStart:           timing.PushStart,
+		PushEnd:             timing.PushEnd,
+		ReceiveHeadersStart: timing.ReceiveHeadersStart,
+		ReceiveHeadersEnd:   timing.ReceiveHeadersEnd,
+	}
+}
+
 func GetHeadersResp(protoHeaders []*fetch.HeaderEntry) map[string]string {
 	hto := make(map[string]string, 0)
 	for _, entry := range protoHeaders {
@@ -444,15 +871,6 @@ func GetHeadersResp(protoHeaders []*fetch.HeaderEntry) map[string]string {
 	return hto
 }
 
-func GetInjection(path string) (string, error) {
-	file, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-
-	return string(file[:]), nil
-}
-
 func normalizeURL(u *url.URL) string {
 	u.Host = strings.ToLower(u.Host)
 	if len(u.Path) == 0 {
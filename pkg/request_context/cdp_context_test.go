@@ -1,15 +1,22 @@
 package requestcontext
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dovydasdo/psec/config"
+	perrors "github.com/dovydasdo/psec/util/errors"
 )
 
 type leveler struct {
@@ -135,4 +142,465 @@ func TestEmulation(t *testing.T) {
 
 }
 
+func TestPaginate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		fmt.Fprintf(w, "<html><body><ul><li class=\"item\">item %v</li></ul>", page)
+		if page < 5 {
+			fmt.Fprintf(w, "<a class=\"next\" href=\"/?page=%v\">next</a>", page+1)
+		}
+		fmt.Fprintln(w, "</body></html>")
+	}))
+	defer ts.Close()
+
+	ctx := getTestContext(t)
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	result, err := ctx.Do(
+		NavigateInstruction{
+			URL:           ts.URL,
+			DoneCondition: DoneElVisible(".item"),
+		},
+		PaginateInstruction{
+			Action:  PaginateFollowLink("a.next"),
+			Stop:    []interface{}{StopMaxPages(3), StopNoNewItems(".item")},
+			Extract: `document.querySelector(".item").textContent`,
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to paginate: %v", err)
+	}
+
+	for _, res := range result {
+		if res.Type != "paginate" {
+			continue
+		}
+
+		pages, ok := res.Value.([]PageResult)
+		if !ok {
+			t.Fatalf("unexpected pagination result type: %T", res.Value)
+		}
+
+		if len(pages) != 3 {
+			t.Fatalf("expected 3 pages, got %v", len(pages))
+		}
+
+		if pages[2].Value != "item 3" {
+			t.Errorf("unexpected extraction result on the last page: %v", pages[2].Value)
+		}
+	}
+}
+
+func TestPaginateClickNavigation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, "<html><body>slow down</body></html>")
+			return
+		}
+
+		fmt.Fprintln(w, `<html><body><li class="item">item 1</li><button class="next" onclick="location.href='/?page=2'">next</button></body></html>`)
+	}))
+	defer ts.Close()
+
+	ctx := getTestContext(t)
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	_, err = ctx.Do(
+		NavigateInstruction{
+			URL:           ts.URL,
+			DoneCondition: DoneElVisible(".item"),
+		},
+		PaginateInstruction{
+			Action: PaginateClickNext("button.next"),
+			Stop:   []interface{}{StopMaxPages(3)},
+		},
+	)
+
+	var blocked perrors.Blocked
+	if !errors.As(err, &blocked) {
+		t.Fatalf("block after a click navigation was not detected: %v", err)
+	}
+
+	if ctx.Navigations() != 2 {
+		t.Errorf("click navigation was not counted, got %v navigations", ctx.Navigations())
+	}
+}
+
+func TestRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+			w.WriteHeader(http.StatusCreated)
+			io.Copy(w, r.Body)
+			return
+		}
+
+		fmt.Fprintln(w, "<html><body><h1>Test</h1></body></html>")
+	}))
+	defer ts.Close()
+
+	ctx := getTestContext(t)
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	result, err := ctx.Do(
+		NavigateInstruction{
+			URL:           ts.URL,
+			DoneCondition: DoneElVisible("h1"),
+		},
+		RequestInstruction{
+			URL:     ts.URL + "/api",
+			Method:  http.MethodPost,
+			Headers: map[string]string{"X-Test": "psec"},
+			Body:    "payload",
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+
+	for _, res := range result {
+		if res.Type != "request" {
+			continue
+		}
+
+		resp, ok := res.Value.(*RequestResponse)
+		if !ok {
+			t.Fatalf("unexpected request result type: %T", res.Value)
+		}
+
+		if resp.Status != http.StatusCreated {
+			t.Errorf("unexpected status: %v", resp.Status)
+		}
+
+		if resp.Headers["x-echo"] != "psec" {
+			t.Errorf("request header was not sent, got: %v", resp.Headers)
+		}
+
+		if string(resp.Body) != "payload" {
+			t.Errorf("unexpected body: %v", string(resp.Body))
+		}
+	}
+}
+
+func TestTabs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/popup" {
+			fmt.Fprintln(w, "<html><body><h1>Popup</h1></body></html>")
+			return
+		}
+
+		fmt.Fprintf(w, "<html><body><h1>%v</h1><a id=\"open\" href=\"/popup\" target=\"_blank\">open</a></body></html>", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx := getTestContext(t)
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	tabs := make([]*Tab, 0)
+	for i := 0; i < 2; i++ {
+		tab, err := ctx.NewTab()
+		if err != nil {
+			t.Fatalf("failed to open tab: %v", err)
+		}
+		tabs = append(tabs, tab)
+	}
+
+	var wg sync.WaitGroup
+	for i, tab := range tabs {
+		wg.Add(1)
+		go func(i int, tab *Tab) {
+			defer wg.Done()
+
+			_, err := tab.Do(NavigateInstruction{
+				URL:           fmt.Sprintf("%v/detail-%v", ts.URL, i),
+				DoneCondition: DoneElVisible("h1"),
+			})
+			if err != nil {
+				t.Errorf("failed to navigate tab %v: %v", i, err)
+			}
+		}(i, tab)
+	}
+	wg.Wait()
+
+	for i, tab := range tabs {
+		if !strings.Contains(tab.GetState().Source, fmt.Sprintf("/detail-%v", i)) {
+			t.Errorf("tab %v has the state of another tab", i)
+		}
+	}
+
+	_, err = ctx.Do(
+		NavigateInstruction{URL: ts.URL, DoneCondition: DoneElVisible("#open")},
+		JSEvalInstruction{Script: `document.querySelector("#open").click()`},
+	)
+	if err != nil {
+		t.Fatalf("failed to open popup: %v", err)
+	}
+
+	popup, err := ctx.WaitPopup(5 * time.Second)
+	if err != nil {
+		t.Fatalf("popup was not captured: %v", err)
+	}
+
+	_, err = popup.Do(JSEvalInstruction{Script: `1`})
+	if err != nil {
+		t.Fatalf("failed to run on popup: %v", err)
+	}
+
+	if len(ctx.Tabs()) != 3 {
+		t.Errorf("expected 3 tabs, got %v", len(ctx.Tabs()))
+	}
+
+	tabs[0].Close()
+	if len(ctx.Tabs()) != 2 {
+		t.Errorf("closed tab is still listed")
+	}
+}
+
+func TestRemote(t *testing.T) {
+	cfg := config.NewCDPLaunchConf()
+	if cfg == nil {
+		t.Fatalf("failed to read config from env variables")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<html><body><h1>Remote</h1></body></html>")
+	}))
+	defer ts.Close()
+
+	browser := exec.Command(cfg.BinPath,
+		"--headless=new",
+		"--remote-debugging-port=9333",
+		"--user-data-dir="+t.TempDir(),
+	)
+	if err := browser.Start(); err != nil {
+		t.Fatalf("failed to launch browser: %v", err)
+	}
+	defer browser.Process.Kill()
+
+	// Give the debugging port time to open
+	time.Sleep(2 * time.Second)
+
+	ctx := GetCDPContext(NewCDPOptions(
+		WithInjectionPath(cfg.InjectionPath),
+		WithRemoteURL("http://127.0.0.1:9333"),
+	))
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	var ua string
+	_, err = ctx.Do(
+		NavigateInstruction{URL: ts.URL, DoneCondition: DoneElVisible("h1")},
+		JSEvalInstruction{Script: `navigator.userAgent`, Result: &ua},
+	)
+	if err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	if strings.Contains(ua, "Headless") {
+		t.Errorf("user agent was not overridden: %v", ua)
+	}
+
+	found := false
+	ctx.State.NetworkEvents.Range(func(key, value interface{}) bool {
+		if ev, ok := value.(*NetworkEvent); ok && strings.HasPrefix(ev.Request.URL, ts.URL) {
+			found = true
+		}
+		return true
+	})
+
+	if !found {
+		t.Errorf("network traffic was not captured")
+	}
+}
+
+func TestDeviceEmulation(t *testing.T) {
+	cfg := config.NewCDPLaunchConf()
+	if cfg == nil {
+		t.Fatalf("failed to read config from env variables")
+	}
+
+	ctx := GetCDPContext(NewCDPOptions(
+		WithInjectionPath(cfg.InjectionPath),
+		WithBinPath(cfg.BinPath),
+		WithDevice(DeviceIPhone),
+		WithTimezone("Asia/Tokyo"),
+		WithLocale("ja-JP"),
+		WithColorScheme("dark"),
+	))
+	defer ctx.Close()
+
+	err := ctx.Initialize()
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	var res struct {
+		Width    int64   `json:"width"`
+		DPR      float64 `json:"dpr"`
+		Touch    int64   `json:"touch"`
+		Timezone string  `json:"timezone"`
+		Locale   string  `json:"locale"`
+		Dark     bool    `json:"dark"`
+	}
+
+	_, err = ctx.Do(JSEvalInstruction{
+		Script: `({
+			width: window.innerWidth,
+			dpr: window.devicePixelRatio,
+			touch: navigator.maxTouchPoints,
+			timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+			locale: Intl.DateTimeFormat().resolvedOptions().locale,
+			dark: matchMedia("(prefers-color-scheme: dark)").matches,
+		})`,
+		Result: &res,
+	})
+	if err != nil {
+		t.Fatalf("failed to eval: %v", err)
+	}
+
+	if res.Width != DeviceIPhone.Width || res.DPR != DeviceIPhone.DeviceScaleFactor || res.Touch == 0 {
+		t.Errorf("device was not emulated: %+v", res)
+	}
+
+	if res.Timezone != "Asia/Tokyo" || res.Locale != "ja-JP" || !res.Dark {
+		t.Errorf("timezone, locale or color scheme were not emulated: %+v", res)
+	}
+}
+
+func getTestContext(t *testing.T) *CDPContext {
+	cfg := config.NewCDPLaunchConf()
+	if cfg == nil {
+		t.Fatalf("failed to read config from env variables")
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: leveler{}}))
+
+	return GetCDPContext(NewCDPOptions(
+		WithInjectionPath(cfg.InjectionPath),
+		WithBinPath(cfg.BinPath),
+		WithLogger(logger),
+	))
+}
+
 // TODO: test proxy
+
+func TestSessionReset(t *testing.T) {
+	cfg := config.NewCDPLaunchConf()
+	if cfg == nil {
+		t.Fatalf("failed to read config from env variables")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Expires: time.Now().Add(time.Hour)})
+		}
+		cookie, _ := r.Cookie("session")
+		fmt.Fprintf(w, "<html><body><h1>%v</h1></body></html>", cookie != nil)
+	}))
+	defer ts.Close()
+
+	ctx := GetCDPContext(NewCDPOptions(
+		WithInjectionPath(cfg.InjectionPath),
+		WithBinPath(cfg.BinPath),
+		WithSessionStore(NewFileSessionStore(t.TempDir()), "test"),
+	))
+	defer ctx.Close()
+
+	if err := ctx.Initialize(); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	if _, err := ctx.Do(NavigateInstruction{URL: ts.URL + "/login", DoneCondition: DoneElVisible("h1")}); err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	// The new session runs in a new browser context, the cookie only gets there through the store
+	ctx.Reset()
+
+	var found string
+	_, err := ctx.Do(
+		NavigateInstruction{URL: ts.URL + "/check", DoneCondition: DoneElVisible("h1")},
+		JSEvalInstruction{Script: `document.querySelector("h1").textContent`, Result: &found},
+	)
+	if err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	if found != "true" {
+		t.Errorf("cookie was not restored after reset")
+	}
+}
+
+func TestRedirectEvents(t *testing.T) {
+	cfg := config.NewCDPLaunchConf()
+	if cfg == nil {
+		t.Fatalf("failed to read config from env variables")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body><h1>Test</h1></body></html>")
+	}))
+	defer ts.Close()
+
+	ctx := GetCDPContext(NewCDPOptions(WithInjectionPath(cfg.InjectionPath), WithBinPath(cfg.BinPath)))
+	defer ctx.Close()
+
+	if err := ctx.Initialize(); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	if _, err := ctx.Do(NavigateInstruction{URL: ts.URL + "/", DoneCondition: DoneElVisible("h1")}); err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	entries := make([]HAREntry, 0)
+	for _, entry := range ctx.GetState().HAR().Log.Entries {
+		if !strings.HasSuffix(entry.Request.URL, "/favicon.ico") {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected the redirect and the page, got %v entries", len(entries))
+	}
+
+	if entries[0].Response.Status != http.StatusFound || entries[0].Response.RedirectURL != "/page" {
+		t.Errorf("redirect hop was not recorded: %+v", entries[0].Response)
+	}
+	if entries[1].Response.Status != http.StatusOK || !strings.HasSuffix(entries[1].Request.URL, "/page") {
+		t.Errorf("unexpected page entry: %+v", entries[1])
+	}
+}
@@ -0,0 +1,386 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+const (
+	donePollInterval       = 100 * time.Millisecond
+	defaultResponseTimeout = 10 * time.Second
+)
+
+// GetDoneAction builds an action that waits for the condition. Event based conditions start
+// listening when the action is built, so it should be built before the action that triggers them.
+// The returned func stops the listeners, it has to be called whether the action ran or not.
+func (c *CDPContext) GetDoneAction(condition interface{}) (chromedp.Action, func(), error) {
+	switch cond := condition.(type) {
+	case DoneElVisible:
+		return chromedp.WaitVisible(cond), noRelease, nil
+	case DoneResponseReceived:
+		action, release := c.waitResponse(URLPattern{Exact: string(cond)}, 0)
+		return action, release, nil
+	case DoneNetworkIdle:
+		action, release := c.waitNetworkIdle(cond.Idle)
+		return withTimeout(action, cond.Timeout), release, nil
+	case DoneElCount:
+		script := fmt.Sprintf(`document.querySelectorAll(%v).length`, jsString(cond.Selector))
+		return withTimeout(pollUntil(func(ctx context.Context) (bool, error) {
+			var count int
+			err := chromedp.Evaluate(script, &count).Do(ctx)
+			return count >= cond.Count, err
+		}), cond.Timeout), noRelease, nil
+	case DoneElTextMatches:
+		if cond.Pattern == nil {
+			return nil, noRelease, errors.New("text match condition requires a pattern")
+		}
+
+		script := fmt.Sprintf(`Array.from(document.querySelectorAll(%v)).map(e => e.textContent)`, jsString(cond.Selector))
+		return withTimeout(pollUntil(func(ctx context.Context) (bool, error) {
+			texts := make([]string, 0)
+			err := chromedp.Evaluate(script, &texts).Do(ctx)
+			for _, text := range texts {
+				if cond.Pattern.MatchString(text) {
+					return true, err
+				}
+			}
+			return false, err
+		}), cond.Timeout), noRelease, nil
+	case DoneJSPredicate:
+		return withTimeout(pollUntil(func(ctx context.Context) (bool, error) {
+			var holds bool
+			err := chromedp.Evaluate(cond.Script, &holds).Do(ctx)
+			return holds, err
+		}), cond.Timeout), noRelease, nil
+	case DoneResponseMatches:
+		pattern := URLPattern{Glob: cond.Glob, Regex: cond.URL}
+		if pattern.String() == "" {
+			return nil, noRelease, errors.New("response match condition requires an url pattern")
+		}
+
+		action, release := c.waitResponse(pattern, cond.Status)
+		return withTimeout(action, cond.Timeout), release, nil
+	case DoneLoad:
+		action, release := c.waitEvent(func(ev interface{}) bool {
+			_, ok := ev.(*page.EventLoadEventFired)
+			return ok
+		})
+		return withTimeout(action, cond.Timeout), release, nil
+	case DoneDOMContentLoaded:
+		action, release := c.waitEvent(func(ev interface{}) bool {
+			_, ok := ev.(*page.EventDomContentEventFired)
+			return ok
+		})
+		return withTimeout(action, cond.Timeout), release, nil
+	case DoneAll:
+		actions, release, err := c.getDoneActions(cond.Conditions)
+		if err != nil {
+			return nil, noRelease, err
+		}
+		return withTimeout(doneAll(actions), cond.Timeout), release, nil
+	case DoneAny:
+		actions, release, err := c.getDoneActions(cond.Conditions)
+		if err != nil {
+			return nil, noRelease, err
+		}
+		return withTimeout(doneAny(actions), cond.Timeout), release, nil
+	default:
+		return nil, noRelease, errors.New("the provided condition was not recognised")
+	}
+}
+
+// getDoneActions releases the conditions built so far if one of them fails
+func (c *CDPContext) getDoneActions(conditions []interface{}) ([]chromedp.Action, func(), error) {
+	if len(conditions) == 0 {
+		return nil, noRelease, errors.New("composite condition requires at least one condition")
+	}
+
+	actions := make([]chromedp.Action, 0, len(conditions))
+	releases := make([]func(), 0, len(conditions))
+	release := func() {
+		for _, fn := range releases {
+			fn()
+		}
+	}
+
+	for _, condition := range conditions {
+		action, r, err := c.GetDoneAction(condition)
+		if err != nil {
+			release()
+			return nil, noRelease, err
+		}
+		actions = append(actions, action)
+		releases = append(releases, r)
+	}
+
+	return actions, release, nil
+}
+
+func noRelease() {}
+
+// listen subscribes fn to the events of the current target until the returned func is called
+func (c *CDPContext) listen(fn func(ev interface{})) context.CancelFunc {
+	lctx, cancel := context.WithCancel(c.ctx)
+	chromedp.ListenTarget(lctx, fn)
+	return cancel
+}
+
+// waitEvent completes once an event matching the predicate has been received
+func (c *CDPContext) waitEvent(match func(ev interface{}) bool) (chromedp.Action, func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	stop := c.listen(func(ev interface{}) {
+		if match(ev) {
+			once.Do(func() { close(done) })
+		}
+	})
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}), stop
+}
+
+// waitResponse completes once the body of a response matching the pattern and status (if not zero) has been stored.
+// Without a deadline on the context the wait is bound by defaultResponseTimeout.
+func (c *CDPContext) waitResponse(pattern URLPattern, status int) (chromedp.Action, func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	matched := make(map[network.RequestID]struct{})
+
+	stopEvents := c.listen(func(ev interface{}) {
+		if ev, ok := ev.(*network.EventResponseReceived); ok {
+			if pattern.Match(ev.Response.URL) && (status == 0 || int(ev.Response.Status) == status) {
+				mu.Lock()
+				matched[ev.RequestID] = struct{}{}
+				mu.Unlock()
+			}
+		}
+	})
+
+	stopBodies := c.responses.subscribe(func(id network.RequestID) {
+		mu.Lock()
+		_, ok := matched[id]
+		mu.Unlock()
+
+		if ok {
+			once.Do(func() { close(done) })
+		}
+	})
+
+	release := func() {
+		stopEvents()
+		stopBodies()
+	}
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		start := time.Now()
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, defaultResponseTimeout)
+			defer cancel()
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return perrors.Timeout{
+					Reason: fmt.Sprintf("no response matching %v was received", pattern),
+					After:  time.Since(start),
+				}
+			}
+			return ctx.Err()
+		}
+	}), release
+}
+
+// waitNetworkIdle completes once no requests have been in flight for the idle duration
+func (c *CDPContext) waitNetworkIdle(idle time.Duration) (chromedp.Action, func()) {
+	var mu sync.Mutex
+	inflight := make(map[network.RequestID]struct{})
+	activity := make(chan struct{}, 1)
+
+	stop := c.listen(func(ev interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			inflight[ev.RequestID] = struct{}{}
+		case *network.EventLoadingFinished:
+			delete(inflight, ev.RequestID)
+		case *network.EventLoadingFailed:
+			delete(inflight, ev.RequestID)
+		default:
+			return
+		}
+
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+	})
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		timer := time.NewTimer(idle)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-activity:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(idle)
+			case <-timer.C:
+				mu.Lock()
+				busy := len(inflight) > 0
+				mu.Unlock()
+
+				if !busy {
+					return nil
+				}
+				timer.Reset(idle)
+			}
+		}
+	}), stop
+}
+
+func pollUntil(check func(ctx context.Context) (bool, error)) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(donePollInterval)
+		defer ticker.Stop()
+
+		for {
+			ok, err := check(ctx)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func withTimeout(action chromedp.Action, timeout time.Duration) chromedp.Action {
+	if timeout <= 0 {
+		return action
+	}
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return action.Do(tctx)
+	})
+}
+
+func doneAll(actions []chromedp.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		actx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, len(actions))
+		for _, action := range actions {
+			go func(action chromedp.Action) {
+				errs <- action.Do(actx)
+			}(action)
+		}
+
+		for range actions {
+			if err := <-errs; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func doneAny(actions []chromedp.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		actx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, len(actions))
+		for _, action := range actions {
+			go func(action chromedp.Action) {
+				errs <- action.Do(actx)
+			}(action)
+		}
+
+		var err error
+		for range actions {
+			if err = <-errs; err == nil {
+				return nil
+			}
+		}
+
+		return err
+	})
+}
+
+// responseHub notifies subscribers once a response has been stored in the state together with its body
+type responseHub struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]func(id network.RequestID)
+}
+
+func newResponseHub() *responseHub {
+	return &responseHub{subs: make(map[int]func(id network.RequestID))}
+}
+
+func (h *responseHub) subscribe(fn func(id network.RequestID)) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.next
+	h.next++
+	h.subs[key] = fn
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, key)
+	}
+}
+
+func (h *responseHub) publish(id network.RequestID) {
+	h.mu.Lock()
+	subs := make([]func(id network.RequestID), 0, len(h.subs))
+	for _, fn := range h.subs {
+		subs = append(subs, fn)
+	}
+	h.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(id)
+	}
+}
@@ -0,0 +1,113 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+func waitAction(d time.Duration, err error) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		select {
+		case <-time.After(d):
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func TestDoneComposition(t *testing.T) {
+	failed := errors.New("failed")
+
+	cases := []struct {
+		name    string
+		action  chromedp.Action
+		wantErr bool
+	}{
+		{"all succeed", doneAll([]chromedp.Action{waitAction(time.Millisecond, nil), waitAction(10*time.Millisecond, nil)}), false},
+		{"all with failure", doneAll([]chromedp.Action{waitAction(time.Millisecond, nil), waitAction(time.Millisecond, failed)}), true},
+		{"any with failure", doneAny([]chromedp.Action{waitAction(time.Millisecond, failed), waitAction(10*time.Millisecond, nil)}), false},
+		{"any all failed", doneAny([]chromedp.Action{waitAction(time.Millisecond, failed), waitAction(time.Millisecond, failed)}), true},
+		{"any first wins", doneAny([]chromedp.Action{waitAction(time.Millisecond, nil), waitAction(time.Hour, nil)}), false},
+		{"timeout", withTimeout(waitAction(time.Hour, nil), 10*time.Millisecond), true},
+		{"nested timeout", doneAny([]chromedp.Action{withTimeout(waitAction(time.Hour, nil), time.Millisecond), waitAction(10*time.Millisecond, nil)}), false},
+	}
+
+	for _, tc := range cases {
+		start := time.Now()
+		err := tc.action.Do(context.Background())
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+		}
+
+		if time.Since(start) > time.Second {
+			t.Errorf("%v: took too long", tc.name)
+		}
+	}
+}
+
+func TestPollUntil(t *testing.T) {
+	calls := 0
+	err := pollUntil(func(ctx context.Context) (bool, error) {
+		calls++
+		return calls == 3, nil
+	}).Do(context.Background())
+
+	if err != nil {
+		t.Errorf("failed to poll: %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 checks, got %v", calls)
+	}
+
+	err = withTimeout(pollUntil(func(ctx context.Context) (bool, error) {
+		return false, nil
+	}), 3*donePollInterval).Do(context.Background())
+
+	if err == nil {
+		t.Errorf("expected polling to time out")
+	}
+}
+
+func TestDoneRelease(t *testing.T) {
+	ctx, cancel := chromedp.NewContext(context.Background())
+	defer cancel()
+
+	c := &CDPContext{ctx: ctx, responses: newResponseHub()}
+
+	_, release, err := c.GetDoneAction(DoneAny{Conditions: []interface{}{
+		DoneResponseReceived("https://example.com/api"),
+		DoneResponseMatches{Glob: "*/api/*"},
+	}})
+	if err != nil {
+		t.Fatalf("failed to build the condition: %v", err)
+	}
+
+	if len(c.responses.subs) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %v", len(c.responses.subs))
+	}
+
+	// The action never ran, the listeners still have to go
+	release()
+	if len(c.responses.subs) != 0 {
+		t.Errorf("subscriptions left after release: %v", len(c.responses.subs))
+	}
+
+	// A failing condition releases the ones built before it
+	_, _, err = c.GetDoneAction(DoneAll{Conditions: []interface{}{
+		DoneResponseReceived("https://example.com/api"),
+		DoneElTextMatches{Selector: "h1"},
+	}})
+	if err == nil {
+		t.Fatalf("expected an error for a condition without a pattern")
+	}
+
+	if len(c.responses.subs) != 0 {
+		t.Errorf("subscriptions left after a failed build: %v", len(c.responses.subs))
+	}
+}
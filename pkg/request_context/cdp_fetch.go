@@ -0,0 +1,80 @@
+package requestcontext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// The body is passed back base64 encoded so that binary responses survive the trip
+const fetchScript = `(async (params) => {
+	const init = { method: params.method, headers: params.headers, credentials: "include" };
+	if (params.body !== "") {
+		init.body = params.body;
+	}
+
+	const resp = await fetch(params.url, init);
+	const buf = new Uint8Array(await resp.arrayBuffer());
+
+	let bin = "";
+	for (let i = 0; i < buf.length; i += 0x8000) {
+		bin += String.fromCharCode.apply(null, buf.subarray(i, i + 0x8000));
+	}
+
+	const headers = {};
+	resp.headers.forEach((v, k) => headers[k] = v);
+
+	return { url: resp.url, status: resp.status, statusText: resp.statusText, headers: headers, body: btoa(bin) };
+})(%s)`
+
+type fetchParams struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// request performs a fetch from within the current page, so cookies, origin and TLS fingerprint of the browser are reused
+func (c *CDPContext) request(ctx context.Context, ins RequestInstruction) (*RequestResponse, error) {
+	if err := ins.filter(ins.URL); err != nil {
+		return nil, err
+	}
+
+	defer c.withInstructionRules(ins.Rules)()
+
+	params := fetchParams{
+		URL:     ins.URL,
+		Method:  ins.Method,
+		Headers: ins.Headers,
+		Body:    ins.Body,
+	}
+
+	if params.Method == "" {
+		params.Method = http.MethodGet
+	}
+
+	if params.Headers == nil {
+		params.Headers = make(map[string]string)
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &RequestResponse{}
+	err = chromedp.Run(ctx,
+		chromedp.Evaluate(fmt.Sprintf(fetchScript, encoded), resp, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+	)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, ins.filter(resp.URL)
+}
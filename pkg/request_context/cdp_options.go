@@ -1,20 +1,70 @@
 package requestcontext
 
-import "log/slog"
+import (
+	"log/slog"
+	"time"
+
+	util "github.com/dovydasdo/psec/util/injections"
+)
 
 type CDPOption func(*CDPOptions)
 
 type CDPOptions struct {
-	BinPath       string
+	BinPath string
+	// InjectionPath is a script file used instead of the embedded stealth bundle
 	InjectionPath string
-	Logger        *slog.Logger
+	// StealthModules of the embedded bundle, all of them by default
+	StealthModules []string
+	// Scripts are injected after the stealth and profile scripts
+	Scripts []Script
+	// RemoteURL connects to a running browser instead of launching BinPath, either a devtools
+	// websocket url or the http address of the debugging port
+	RemoteURL string
+	// RemoteToken is sent as the token query parameter, as browserless expects it
+	RemoteToken string
+	// Timeout is the default deadline of a single instruction
+	Timeout time.Duration
+	// Registry holds handlers for custom instructions, DefaultRegistry is used if nil
+	Registry *Registry
+	// InterceptRules are applied to every request
+	InterceptRules []InterceptRule
+	Emulation      Emulation
+	// Profile fixes the fingerprint, otherwise one is generated per proxy identity and kept in ProfileStore
+	Profile      *FingerprintProfile
+	ProfileStore ProfileStore
+	// EmulatorData is where profiles get the browser data from, the embedded snapshot if nil
+	EmulatorData util.Source
+	// OSProfiles are picked from by weight for every new profile, util.OSProfiles if empty
+	OSProfiles []util.OSProfile
+	// BrowserVersion of the emulator data, zero for the version of the launched browser
+	BrowserVersion int
+	// VersionMatch is what happens if there is no data for the launched browser version
+	VersionMatch int
+	// BlockDetector runs after every navigation, nil disables detection
+	BlockDetector BlockDetector
+	// SessionStore saves cookies and storage on Reset and Close and restores them on Initialize,
+	// sessions are keyed by SessionSite and the identity of the proxy
+	SessionStore SessionStore
+	SessionSite  string
+	// ExitIPURL answers with the ip address of the caller, if set the exit of every session is checked
+	// and a proxy change that kept the same exit fails Initialize, Reset switches the proxy again
+	ExitIPURL string
+	// ForwardProxy points a launched browser at a local proxy that forwards to the agent's proxy, so the
+	// upstream can change without a new session and the traffic is counted. The local proxy only lets in
+	// the browser, with credentials made for every launch
+	ForwardProxy bool
+	Logger       *slog.Logger
 }
 
 func NewCDPOptions(setters ...CDPOption) *CDPOptions {
 	options := &CDPOptions{
 		// Defualts
-		BinPath:       "",
-		InjectionPath: "./injection.js",
+		BinPath:        "",
+		InjectionPath:  "",
+		StealthModules: util.StealthModules(),
+		Timeout:        30 * time.Second,
+		BlockDetector:  NewBlockDetector(),
+		ForwardProxy:   true,
 	}
 
 	for _, setter := range setters {
@@ -41,3 +91,211 @@ func WithLogger(logger *slog.Logger) CDPOption {
 		c.Logger = logger
 	}
 }
+
+func WithTimeout(timeout time.Duration) CDPOption {
+	return func(c *CDPOptions) {
+		c.Timeout = timeout
+	}
+}
+
+func WithRegistry(registry *Registry) CDPOption {
+	return func(c *CDPOptions) {
+		c.Registry = registry
+	}
+}
+
+func WithInterceptRules(rules ...InterceptRule) CDPOption {
+	return func(c *CDPOptions) {
+		c.InterceptRules = append(c.InterceptRules, rules...)
+	}
+}
+
+func WithBlockDetector(detector BlockDetector) CDPOption {
+	return func(c *CDPOptions) {
+		c.BlockDetector = detector
+	}
+}
+
+// WithBlockRules adds site specific rules to the default detector, keeping the ones set before.
+// A custom detector or a disabled one is replaced with a default detector holding the rules
+func WithBlockRules(rules ...BlockRule) CDPOption {
+	return func(c *CDPOptions) {
+		detector, ok := c.BlockDetector.(*DefaultBlockDetector)
+		if !ok || detector == nil {
+			c.BlockDetector = NewBlockDetector(rules...)
+			return
+		}
+
+		// copy so a detector shared between options is not changed
+		extended := *detector
+		extended.Rules = append(append([]BlockRule{}, detector.Rules...), rules...)
+		c.BlockDetector = &extended
+	}
+}
+
+func WithSessionStore(store SessionStore, site string) CDPOption {
+	return func(c *CDPOptions) {
+		c.SessionStore = store
+		c.SessionSite = site
+	}
+}
+
+func WithRemoteURL(url string) CDPOption {
+	return func(c *CDPOptions) {
+		c.RemoteURL = url
+	}
+}
+
+func WithRemoteToken(token string) CDPOption {
+	return func(c *CDPOptions) {
+		c.RemoteToken = token
+	}
+}
+
+func WithHeadless(headless bool) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Headful = !headless
+	}
+}
+
+func WithWindowSize(width, height int) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.WindowWidth = width
+		c.Emulation.WindowHeight = height
+	}
+}
+
+// WithViewport sets a desktop viewport, use WithDevice for mobile ones
+func WithViewport(width, height int64, scale float64) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Device = &Device{
+			Name:              "custom",
+			Width:             width,
+			Height:            height,
+			ScreenWidth:       width,
+			ScreenHeight:      height,
+			DeviceScaleFactor: scale,
+		}
+	}
+}
+
+func WithDevice(device Device) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Device = &device
+	}
+}
+
+func WithTimezone(timezone string) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Timezone = timezone
+	}
+}
+
+func WithLocale(locale string) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Locale = locale
+	}
+}
+
+func WithGeolocation(latitude, longitude, accuracy float64) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.Geolocation = &Geolocation{Latitude: latitude, Longitude: longitude, Accuracy: accuracy}
+	}
+}
+
+func WithColorScheme(scheme string) CDPOption {
+	return func(c *CDPOptions) {
+		c.Emulation.ColorScheme = scheme
+	}
+}
+
+func WithProfile(profile *FingerprintProfile) CDPOption {
+	return func(c *CDPOptions) {
+		c.Profile = profile
+	}
+}
+
+func WithProfileStore(store ProfileStore) CDPOption {
+	return func(c *CDPOptions) {
+		c.ProfileStore = store
+	}
+}
+
+// WithEmulatorData sets the source of the browser data, util.NewOnlineSource keeps it up to date
+func WithEmulatorData(source util.Source) CDPOption {
+	return func(c *CDPOptions) {
+		c.EmulatorData = source
+	}
+}
+
+func WithOSProfiles(profiles ...util.OSProfile) CDPOption {
+	return func(c *CDPOptions) {
+		c.OSProfiles = profiles
+	}
+}
+
+// WithOS makes every profile use the named os of util.OSProfiles, other names are used as the
+// directory of the dataset
+func WithOS(name string) CDPOption {
+	return func(c *CDPOptions) {
+		os, err := util.GetOSProfile(name)
+		if err != nil {
+			os = util.OSProfile{Name: name, Dir: name}
+		}
+
+		os.Weight = 1
+		c.OSProfiles = []util.OSProfile{os}
+	}
+}
+
+func WithBrowserVersion(version int) CDPOption {
+	return func(c *CDPOptions) {
+		c.BrowserVersion = version
+	}
+}
+
+func WithVersionMatch(match int) CDPOption {
+	return func(c *CDPOptions) {
+		c.VersionMatch = match
+	}
+}
+
+func WithStealthModules(modules ...string) CDPOption {
+	return func(c *CDPOptions) {
+		c.StealthModules = modules
+	}
+}
+
+func WithoutStealthModules(modules ...string) CDPOption {
+	return func(c *CDPOptions) {
+		enabled := make([]string, 0, len(c.StealthModules))
+		for _, module := range c.StealthModules {
+			disabled := false
+			for _, name := range modules {
+				disabled = disabled || name == module
+			}
+			if !disabled {
+				enabled = append(enabled, module)
+			}
+		}
+		c.StealthModules = enabled
+	}
+}
+
+func WithScripts(scripts ...Script) CDPOption {
+	return func(c *CDPOptions) {
+		c.Scripts = append(c.Scripts, scripts...)
+	}
+}
+
+func WithExitIPCheck(url string) CDPOption {
+	return func(c *CDPOptions) {
+		c.ExitIPURL = url
+	}
+}
+
+func WithForwardProxy(enabled bool) CDPOption {
+	return func(c *CDPOptions) {
+		c.ForwardProxy = enabled
+	}
+}
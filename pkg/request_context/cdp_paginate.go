@@ -0,0 +1,232 @@
+package requestcontext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+func (c *CDPContext) paginate(ctx context.Context, ins PaginateInstruction) ([]PageResult, error) {
+	defer c.withInstructionRules(ins.Rules)()
+
+	pages := make([]PageResult, 0)
+	seen := make(map[string]struct{})
+
+	for page := 1; ; page++ {
+		res := PageResult{Page: page}
+
+		err := chromedp.Run(ctx, chromedp.Location(&res.URL))
+		if err != nil {
+			return pages, err
+		}
+
+		if ins.Extract != "" {
+			err = chromedp.Run(ctx, chromedp.Evaluate(ins.Extract, &res.Value))
+			if err != nil {
+				return pages, err
+			}
+		}
+
+		stop, err := c.paginationStop(ctx, ins.Stop, page, seen, &res)
+		pages = append(pages, res)
+		if err != nil || stop {
+			return pages, err
+		}
+
+		more, err := c.paginationStep(ctx, ins)
+		if err != nil || !more {
+			return pages, err
+		}
+
+		c.logger.Debug("cdp.paginate", "page done", page, "url", res.URL)
+	}
+}
+
+func (c *CDPContext) paginationStop(ctx context.Context, conditions []interface{}, page int, seen map[string]struct{}, res *PageResult) (bool, error) {
+	for _, condition := range conditions {
+		if sel, ok := condition.(StopNoNewItems); ok {
+			newItems, err := c.countNewItems(ctx, string(sel), seen)
+			if err != nil {
+				return true, err
+			}
+			res.NewItems = newItems
+		}
+	}
+
+	for _, condition := range conditions {
+		switch cond := condition.(type) {
+		case StopMaxPages:
+			if page >= int(cond) {
+				return true, nil
+			}
+		case StopNoNewItems:
+			if res.NewItems == 0 {
+				return true, nil
+			}
+		case StopJSPredicate:
+			var holds bool
+			err := chromedp.Run(ctx, chromedp.Evaluate(string(cond), &holds))
+			if err != nil {
+				return true, err
+			}
+
+			if holds {
+				return true, nil
+			}
+		default:
+			return true, errors.New("the provided stop condition was not recognised")
+		}
+	}
+
+	return false, nil
+}
+
+// countNewItems marks the items matched by the selector as seen and returns how many were not seen before
+func (c *CDPContext) countNewItems(ctx context.Context, selector string, seen map[string]struct{}) (int, error) {
+	items := make([]string, 0)
+	script := fmt.Sprintf(`Array.from(document.querySelectorAll(%v)).map(e => e.outerHTML)`, jsString(selector))
+
+	err := chromedp.Run(ctx, chromedp.Evaluate(script, &items))
+	if err != nil {
+		return 0, err
+	}
+
+	newItems := 0
+	for _, item := range items {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		newItems++
+	}
+
+	return newItems, nil
+}
+
+// paginationStep performs the pagination action, false is returned when there is nowhere to go
+func (c *CDPContext) paginationStep(ctx context.Context, ins PaginateInstruction) (bool, error) {
+	wait, release, err := c.paginationWait(ins)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	// a click can start a real navigation, the loader of the main frame tells if it did
+	var loader cdp.LoaderID
+	navigated := false
+
+	switch action := ins.Action.(type) {
+	case PaginateClickNext:
+		var clickable bool
+		script := fmt.Sprintf(`(() => {
+			const el = document.querySelector(%v);
+			return !!el && !el.disabled && el.getAttribute('aria-disabled') !== 'true';
+		})()`, jsString(string(action)))
+
+		err = chromedp.Run(ctx, chromedp.Evaluate(script, &clickable))
+		if err != nil || !clickable {
+			return false, err
+		}
+
+		loader, err = c.mainLoaderID(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		err = chromedp.Run(ctx, chromedp.Click(string(action), chromedp.ByQuery))
+		if err != nil {
+			return false, err
+		}
+	case PaginateFollowLink:
+		var href string
+		script := fmt.Sprintf(`(() => {
+			const el = document.querySelector(%v);
+			return el && el.href ? el.href : "";
+		})()`, jsString(string(action)))
+
+		err = chromedp.Run(ctx, chromedp.Evaluate(script, &href))
+		if err != nil || href == "" {
+			return false, err
+		}
+
+		c.setDocument(nil)
+		c.countNavigation()
+		navigated = true
+
+		err = chromedp.Run(ctx, chromedp.Navigate(href))
+		if err != nil {
+			return false, err
+		}
+	case PaginateScroll:
+		err = chromedp.Run(ctx, chromedp.Evaluate(`window.scrollTo(0, document.documentElement.scrollHeight)`, nil))
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, errors.New("the provided pagination action was not recognised")
+	}
+
+	err = chromedp.Run(ctx, wait)
+	if err != nil {
+		return false, err
+	}
+
+	if loader != "" {
+		current, err := c.mainLoaderID(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		if current != loader {
+			c.countNavigation()
+			navigated = true
+		}
+	}
+
+	if navigated {
+		return true, c.detectBlock(ctx)
+	}
+
+	return true, nil
+}
+
+// mainLoaderID returns the loader of the document in the main frame, every navigation gets a new one
+func (c *CDPContext) mainLoaderID(ctx context.Context) (cdp.LoaderID, error) {
+	var tree *page.FrameTree
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		tree, err = page.GetFrameTree().Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return "", err
+	}
+
+	return tree.Frame.LoaderID, nil
+}
+
+// paginationWait is built before the action is performed so that event based conditions do not miss anything
+func (c *CDPContext) paginationWait(ins PaginateInstruction) (chromedp.Action, func(), error) {
+	if ins.DoneCondition != nil {
+		return c.GetDoneAction(ins.DoneCondition)
+	}
+
+	delay := ins.Delay
+	if delay == 0 {
+		delay = time.Second
+	}
+
+	return chromedp.Sleep(delay), noRelease, nil
+}
+
+// jsString quotes s as a javascript string literal
+func jsString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
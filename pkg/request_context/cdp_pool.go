@@ -0,0 +1,284 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrPoolClosed = errors.New("pool is closed")
+
+// CDPPool leases initialized browsers to concurrent workers. Browsers are recycled once they get
+// too old or have navigated too many times, and ones that stop responding are replaced.
+type CDPPool struct {
+	opts   *CDPPoolOptions
+	logger *slog.Logger
+
+	// slots limits the number of browsers, a slot is taken for every leased or idle browser
+	slots chan struct{}
+
+	// idle holds the browsers waiting for a lease, Acquire takes them as soon as they are put back
+	idle chan *pooledContext
+
+	mu     sync.Mutex
+	leased map[*CDPContext]*pooledContext
+	closed bool
+
+	ping        func(c *CDPContext, timeout time.Duration) error
+	pingTimeout time.Duration
+	stop        chan struct{}
+}
+
+type pooledContext struct {
+	ctx     *CDPContext
+	created time.Time
+}
+
+func NewCDPPool(opts *CDPPoolOptions) *CDPPool {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	size := opts.Size
+	if size <= 0 {
+		size = 1
+	}
+
+	pingTimeout := opts.PingTimeout
+	if pingTimeout <= 0 {
+		pingTimeout = browserPingTimeout
+	}
+
+	p := &CDPPool{
+		opts:        opts,
+		logger:      logger,
+		slots:       make(chan struct{}, size),
+		idle:        make(chan *pooledContext, size),
+		leased:      make(map[*CDPContext]*pooledContext),
+		ping:        (*CDPContext).Ping,
+		pingTimeout: pingTimeout,
+		stop:        make(chan struct{}),
+	}
+
+	if opts.HealthInterval > 0 {
+		go p.checkHealth()
+	}
+
+	return p
+}
+
+// Acquire returns a healthy browser, waiting for one to be released if the pool is at its size
+func (p *CDPPool) Acquire(ctx context.Context) (*CDPContext, error) {
+	for {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return nil, ErrPoolClosed
+		}
+
+		// An idle browser is preferred over launching a new one
+		var pc *pooledContext
+		select {
+		case pc = <-p.idle:
+		default:
+			select {
+			case pc = <-p.idle:
+			case p.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-p.stop:
+				return nil, ErrPoolClosed
+			}
+		}
+
+		if pc == nil {
+			created, err := p.create()
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			pc = created
+		} else if !p.usable(pc) {
+			// The slot of an idle browser is handed over with it
+			p.discard(pc)
+			continue
+		}
+
+		p.lease(pc)
+		return pc.ctx, nil
+	}
+}
+
+// Release returns the browser to the pool, it is closed instead if it should be recycled
+func (p *CDPPool) Release(c *CDPContext) {
+	p.mu.Lock()
+	pc, ok := p.leased[c]
+	delete(p.leased, c)
+	closed := p.closed
+	p.mu.Unlock()
+
+	if !ok {
+		p.logger.Warn("cdp.pool", "message", "released a context that is not leased from the pool")
+		return
+	}
+
+	if closed || !p.usable(pc) {
+		p.discard(pc)
+		return
+	}
+
+	p.put(pc)
+}
+
+// put hands an idle browser to a waiting Acquire or keeps it for the next one. Every idle browser
+// holds a slot, so the channel always has room for it.
+func (p *CDPPool) put(pc *pooledContext) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(pc)
+		return
+	}
+
+	p.idle <- pc
+	p.mu.Unlock()
+}
+
+// Close closes the idle browsers, leased ones are closed when released
+func (p *CDPPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+
+	p.closed = true
+	close(p.stop)
+	idle := p.drain()
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		p.discard(pc)
+	}
+}
+
+// drain takes the browsers that are idle right now
+func (p *CDPPool) drain() []*pooledContext {
+	idle := make([]*pooledContext, 0, len(p.idle))
+	for {
+		select {
+		case pc := <-p.idle:
+			idle = append(idle, pc)
+		default:
+			return idle
+		}
+	}
+}
+
+// Len returns the number of leased and idle browsers
+func (p *CDPPool) Len() int {
+	return len(p.slots)
+}
+
+func (p *CDPPool) create() (*pooledContext, error) {
+	var c *CDPContext
+	var err error
+
+	if p.opts.Factory != nil {
+		c, err = p.opts.Factory()
+	} else {
+		c = GetCDPContext(NewCDPOptions(p.opts.ContextOptions...))
+		err = c.Initialize()
+		if err != nil {
+			c.Close()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Debug("cdp.pool", "message", "browser started")
+
+	return &pooledContext{ctx: c, created: time.Now()}, nil
+}
+
+func (p *CDPPool) lease(pc *pooledContext) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.leased[pc.ctx] = pc
+}
+
+// discard closes the browser and frees its slot
+func (p *CDPPool) discard(pc *pooledContext) {
+	pc.ctx.Close()
+	<-p.slots
+}
+
+func (p *CDPPool) expired(pc *pooledContext) bool {
+	if p.opts.MaxAge > 0 && time.Since(pc.created) > p.opts.MaxAge {
+		return true
+	}
+
+	return p.opts.MaxNavigations > 0 && pc.ctx.Navigations() >= p.opts.MaxNavigations
+}
+
+func (p *CDPPool) usable(pc *pooledContext) bool {
+	if p.expired(pc) {
+		p.logger.Debug("cdp.pool", "message", "recycling browser", "age", time.Since(pc.created), "navigations", pc.ctx.Navigations())
+		return false
+	}
+
+	if err := p.ping(pc.ctx, p.pingTimeout); err != nil {
+		p.logger.Warn("cdp.pool", "message", "browser is not responding, replacing", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// checkHealth replaces idle browsers that crashed or expired, so a worker does not have to wait for the launch.
+// Browsers are checked one at a time, the others stay available to Acquire meanwhile.
+func (p *CDPPool) checkHealth() {
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for i := len(p.idle); i > 0; i-- {
+			var pc *pooledContext
+			select {
+			case pc = <-p.idle:
+			default:
+			}
+			if pc == nil {
+				break
+			}
+
+			if p.usable(pc) {
+				p.put(pc)
+				continue
+			}
+
+			pc.ctx.Close()
+
+			replacement, err := p.create()
+			if err != nil {
+				p.logger.Error("cdp.pool", "message", "failed to replace browser", "error", err)
+				<-p.slots
+				continue
+			}
+			p.put(replacement)
+		}
+	}
+}
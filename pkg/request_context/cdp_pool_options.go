@@ -0,0 +1,91 @@
+package requestcontext
+
+import (
+	"log/slog"
+	"time"
+)
+
+type CDPPoolOption func(opts *CDPPoolOptions)
+
+type CDPPoolOptions struct {
+	// Size is the maximum number of browsers, leased and idle
+	Size int
+	// MaxNavigations recycles a browser after that many navigations, zero disables it
+	MaxNavigations int64
+	// MaxAge recycles a browser after it has been running that long, zero disables it
+	MaxAge time.Duration
+	// HealthInterval is how often idle browsers are pinged, zero disables the checks
+	HealthInterval time.Duration
+	// PingTimeout bounds a single health check, zero means the default of five seconds
+	PingTimeout time.Duration
+	// ContextOptions are used to create the browsers if Factory is not set
+	ContextOptions []CDPOption
+	// Factory creates an initialized context, for example one with a proxy agent registered
+	Factory func() (*CDPContext, error)
+	Logger  *slog.Logger
+}
+
+func NewCDPPoolOptions(setters ...CDPPoolOption) *CDPPoolOptions {
+	opts := &CDPPoolOptions{
+		// Defaults
+		Size:           4,
+		MaxNavigations: 100,
+		MaxAge:         30 * time.Minute,
+		HealthInterval: 30 * time.Second,
+		PingTimeout:    5 * time.Second,
+	}
+
+	for _, setter := range setters {
+		setter(opts)
+	}
+
+	return opts
+}
+
+func WithPoolSize(size int) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.Size = size
+	}
+}
+
+func WithMaxNavigations(navigations int64) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.MaxNavigations = navigations
+	}
+}
+
+func WithMaxAge(age time.Duration) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.MaxAge = age
+	}
+}
+
+func WithHealthInterval(interval time.Duration) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.HealthInterval = interval
+	}
+}
+
+func WithPingTimeout(timeout time.Duration) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.PingTimeout = timeout
+	}
+}
+
+func WithContextOptions(setters ...CDPOption) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.ContextOptions = append(opts.ContextOptions, setters...)
+	}
+}
+
+func WithContextFactory(factory func() (*CDPContext, error)) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.Factory = factory
+	}
+}
+
+func WithPoolLogger(logger *slog.Logger) CDPPoolOption {
+	return func(opts *CDPPoolOptions) {
+		opts.Logger = logger
+	}
+}
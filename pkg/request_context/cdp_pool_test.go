@@ -0,0 +1,198 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getTestPool(size int) (*CDPPool, *int64) {
+	var created int64
+	pool := NewCDPPool(NewCDPPoolOptions(
+		WithPoolSize(size),
+		WithMaxNavigations(2),
+		WithHealthInterval(0),
+		WithContextFactory(func() (*CDPContext, error) {
+			atomic.AddInt64(&created, 1)
+			return GetCDPContext(NewCDPOptions()), nil
+		}),
+	))
+
+	pool.ping = func(c *CDPContext, timeout time.Duration) error {
+		return nil
+	}
+
+	return pool, &created
+}
+
+func TestPoolAcquire(t *testing.T) {
+	pool, created := getTestPool(2)
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	second, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over the pool size should wait, got: %v", err)
+	}
+
+	pool.Release(first)
+
+	reused, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	if reused != first || *created != 2 {
+		t.Errorf("released browser was not reused, created %v", *created)
+	}
+
+	pool.Release(second)
+	pool.Release(reused)
+
+	if pool.Len() != 2 {
+		t.Errorf("expected 2 browsers in the pool, got %v", pool.Len())
+	}
+}
+
+func TestPoolWaiter(t *testing.T) {
+	pool, _ := getTestPool(1)
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	// The waiter has to get the browser once it is released, not only when a slot frees up
+	got := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		c, err := pool.Acquire(ctx)
+		if err == nil && c != first {
+			err = errors.New("waiter did not get the released browser")
+		}
+		got <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	pool.Release(first)
+
+	if err := <-got; err != nil {
+		t.Errorf("waiter was not woken by the release: %v", err)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	pool, created := getTestPool(2)
+	pool.opts.MaxNavigations = 0
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				c, err := pool.Acquire(ctx)
+				cancel()
+				if err != nil {
+					errs <- err
+					return
+				}
+				pool.Release(c)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("failed to acquire: %v", err)
+	}
+
+	if *created > 2 || pool.Len() > 2 {
+		t.Errorf("pool grew over its size, created %v, len %v", *created, pool.Len())
+	}
+}
+
+func TestPoolRecycle(t *testing.T) {
+	pool, created := getTestPool(1)
+	defer pool.Close()
+
+	c, _ := pool.Acquire(context.Background())
+	atomic.AddInt64(&c.navigations, 2)
+	pool.Release(c)
+
+	if pool.Len() != 0 {
+		t.Errorf("browser over the navigation limit was not closed")
+	}
+
+	c, _ = pool.Acquire(context.Background())
+	pool.Release(c)
+
+	pool.ping = func(c *CDPContext, timeout time.Duration) error {
+		return errors.New("target crashed")
+	}
+
+	replaced, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	if replaced == c || *created != 3 {
+		t.Errorf("crashed browser was not replaced, created %v", *created)
+	}
+
+	pool.Close()
+
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("acquire on a closed pool should fail, got: %v", err)
+	}
+}
+
+func TestPoolDefaults(t *testing.T) {
+	pool := NewCDPPool(&CDPPoolOptions{
+		Factory: func() (*CDPContext, error) {
+			return GetCDPContext(NewCDPOptions()), nil
+		},
+	})
+	defer pool.Close()
+
+	var timeout time.Duration
+	pool.ping = func(c *CDPContext, t time.Duration) error {
+		timeout = t
+		return nil
+	}
+
+	c, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	pool.Release(c)
+
+	if _, err := pool.Acquire(context.Background()); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	if timeout != browserPingTimeout {
+		t.Errorf("zero ping timeout was not defaulted, got %v", timeout)
+	}
+}
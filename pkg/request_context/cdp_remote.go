@@ -0,0 +1,44 @@
+package requestcontext
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// newRemoteAllocator connects to a browser that is already running. The proxy is set per session the
+// same as for a launched browser, services that do not allow browser contexts with a proxy will fail.
+func (c *CDPContext) newRemoteAllocator() (context.Context, context.CancelFunc) {
+	wsURL, direct := remoteAllocatorURL(c.remoteURL, c.remoteToken)
+
+	opts := make([]chromedp.RemoteAllocatorOption, 0)
+	if direct {
+		opts = append(opts, chromedp.NoModifyURL)
+	}
+
+	c.logger.Debug("cdp", "message", "connecting to remote browser", "url", c.remoteURL, "direct", direct)
+
+	return chromedp.NewRemoteAllocator(context.Background(), wsURL, opts...)
+}
+
+// remoteAllocatorURL adds the token to the url and reports if it should be dialed as is. Websocket urls
+// that do not point to a devtools path belong to services like browserless, everything else is
+// resolved through /json/version of the debugging port.
+func remoteAllocatorURL(rawURL, token string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL, false
+	}
+
+	if token != "" {
+		query := u.Query()
+		query.Set("token", token)
+		u.RawQuery = query.Encode()
+	}
+
+	direct := (u.Scheme == "ws" || u.Scheme == "wss") && !strings.Contains(u.Path, "/devtools/")
+
+	return u.String(), direct
+}
@@ -0,0 +1,24 @@
+package requestcontext
+
+import "testing"
+
+func TestRemoteAllocatorURL(t *testing.T) {
+	cases := []struct {
+		url    string
+		token  string
+		result string
+		direct bool
+	}{
+		{"http://127.0.0.1:9222", "", "http://127.0.0.1:9222", false},
+		{"ws://127.0.0.1:9222/devtools/browser/abc", "", "ws://127.0.0.1:9222/devtools/browser/abc", false},
+		{"wss://chrome.browserless.io", "secret", "wss://chrome.browserless.io?token=secret", true},
+		{"wss://chrome.browserless.io/?stealth=true", "secret", "wss://chrome.browserless.io/?stealth=true&token=secret", true},
+	}
+
+	for _, c := range cases {
+		result, direct := remoteAllocatorURL(c.url, c.token)
+		if result != c.result || direct != c.direct {
+			t.Errorf("%v: expected %v %v, got %v %v", c.url, c.result, c.direct, result, direct)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package requestcontext
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// VERSION_MATCH_WARN uses the data of the browser version if there is some, the newest otherwise
+	VERSION_MATCH_WARN = iota
+	// VERSION_MATCH_FAIL fails Initialize if there is no data for the browser version
+	VERSION_MATCH_FAIL
+	// VERSION_MATCH_OFF always uses the newest data
+	VERSION_MATCH_OFF
+)
+
+var productVersion = regexp.MustCompile(`/(\d+)\.`)
+
+// majorVersion reads the major version from a product like HeadlessChrome/118.0.5993.70 or a full
+// version like 118.0.5993.70
+func majorVersion(version string) (int, error) {
+	match := productVersion.FindStringSubmatch("/" + version)
+	if match == nil {
+		return 0, fmt.Errorf("no version in %q", version)
+	}
+
+	return strconv.Atoi(match[1])
+}
+
+// detectBrowserVersion reads the major version of the launched browser
+func (c *CDPContext) detectBrowserVersion() error {
+	return chromedp.Run(c.browser, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, product, _, _, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Browser))
+		if err != nil {
+			return err
+		}
+
+		c.detectedVersion, err = majorVersion(product)
+		c.logger.Debug("cdp", "message", "detected browser version", "product", product)
+		return err
+	}))
+}
+
+// profileVersion is the browser version the emulator data should be for, zero means the newest
+func (c *CDPContext) profileVersion() int {
+	if c.browserVersion != 0 || c.versionMatch == VERSION_MATCH_OFF {
+		return c.browserVersion
+	}
+
+	return c.detectedVersion
+}
+
+// checkProfileVersion reports a profile that does not match the version the data was asked for
+func (c *CDPContext) checkProfileVersion(profile *FingerprintProfile) error {
+	want := c.profileVersion()
+	if want == 0 {
+		return nil
+	}
+
+	got, err := majorVersion(profile.Hints.UaFullVersion)
+	if err == nil && got == want {
+		return nil
+	}
+
+	mismatch := fmt.Errorf("no emulator data for browser version %v, profile is for %v", want, profile.Hints.UaFullVersion)
+	if c.versionMatch == VERSION_MATCH_FAIL {
+		return mismatch
+	}
+
+	c.logger.Warn("cdp", "message", "user agent does not match the browser", "error", mismatch)
+	return nil
+}
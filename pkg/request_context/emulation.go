@@ -0,0 +1,123 @@
+package requestcontext
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// Emulation is applied to every target on Initialize and Reset, zero values keep the browser defaults
+type Emulation struct {
+	// Headful shows the browser window, only applies to a locally launched browser
+	Headful      bool
+	WindowWidth  int
+	WindowHeight int
+	Device       *Device
+	// Timezone is an IANA id like Europe/Vilnius
+	Timezone string
+	// Locale like lt-LT, it also becomes the Accept-Language
+	Locale      string
+	Geolocation *Geolocation
+	// ColorScheme is light or dark
+	ColorScheme string
+}
+
+// Device sets the viewport metrics, the user agent is left to the fingerprint data
+type Device struct {
+	Name              string
+	Width             int64
+	Height            int64
+	ScreenWidth       int64
+	ScreenHeight      int64
+	DeviceScaleFactor float64
+	Mobile            bool
+	Touch             bool
+}
+
+type Geolocation struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64
+}
+
+var (
+	DeviceDesktop = Device{Name: "desktop", Width: 1920, Height: 969, ScreenWidth: 1920, ScreenHeight: 1080, DeviceScaleFactor: 1}
+	DeviceLaptop  = Device{Name: "laptop", Width: 1536, Height: 730, ScreenWidth: 1536, ScreenHeight: 864, DeviceScaleFactor: 1.25}
+	DeviceIPhone  = Device{Name: "iphone", Width: 390, Height: 664, ScreenWidth: 390, ScreenHeight: 844, DeviceScaleFactor: 3, Mobile: true, Touch: true}
+	DevicePixel   = Device{Name: "pixel", Width: 412, Height: 839, ScreenWidth: 412, ScreenHeight: 915, DeviceScaleFactor: 2.625, Mobile: true, Touch: true}
+	DeviceIPad    = Device{Name: "ipad", Width: 820, Height: 1106, ScreenWidth: 820, ScreenHeight: 1180, DeviceScaleFactor: 2, Mobile: true, Touch: true}
+)
+
+// maxTouchPoints matches what mobile chrome reports
+const maxTouchPoints = 5
+
+func (e Emulation) allocatorOptions() []chromedp.ExecAllocatorOption {
+	opts := make([]chromedp.ExecAllocatorOption, 0)
+
+	if e.Headful {
+		opts = append(opts, chromedp.Flag("headless", false), chromedp.Flag("hide-scrollbars", false), chromedp.Flag("mute-audio", false))
+	}
+
+	if e.WindowWidth > 0 && e.WindowHeight > 0 {
+		opts = append(opts, chromedp.WindowSize(e.WindowWidth, e.WindowHeight))
+	}
+
+	if e.Locale != "" {
+		opts = append(opts, chromedp.Flag("lang", e.Locale))
+	}
+
+	return opts
+}
+
+func (e Emulation) actions() []chromedp.Action {
+	actions := make([]chromedp.Action, 0)
+
+	if d := e.Device; d != nil {
+		actions = append(actions, emulation.SetDeviceMetricsOverride(d.Width, d.Height, d.DeviceScaleFactor, d.Mobile).
+			WithScreenWidth(d.ScreenWidth).
+			WithScreenHeight(d.ScreenHeight))
+
+		if d.Touch {
+			actions = append(actions,
+				emulation.SetTouchEmulationEnabled(true).WithMaxTouchPoints(maxTouchPoints),
+				emulation.SetEmitTouchEventsForMouse(true),
+			)
+		}
+	}
+
+	if e.Timezone != "" {
+		actions = append(actions, emulation.SetTimezoneOverride(e.Timezone))
+	}
+
+	if e.Locale != "" {
+		actions = append(actions, emulation.SetLocaleOverride().WithLocale(e.Locale))
+	}
+
+	if g := e.Geolocation; g != nil {
+		accuracy := g.Accuracy
+		if accuracy <= 0 {
+			accuracy = 100
+		}
+
+		actions = append(actions,
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				// Permissions belong to the browser, not the target
+				c := chromedp.FromContext(ctx)
+				return browser.GrantPermissions([]browser.PermissionType{browser.PermissionTypeGeolocation}).
+					Do(cdp.WithExecutor(ctx, c.Browser))
+			}),
+			emulation.SetGeolocationOverride().WithLatitude(g.Latitude).WithLongitude(g.Longitude).WithAccuracy(accuracy),
+		)
+	}
+
+	if e.ColorScheme != "" {
+		actions = append(actions, emulation.SetEmulatedMedia().WithFeatures([]*emulation.MediaFeature{
+			{Name: "prefers-color-scheme", Value: e.ColorScheme},
+		}))
+	}
+
+	return actions
+}
@@ -0,0 +1,48 @@
+package requestcontext
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/emulation"
+)
+
+func TestEmulationOptions(t *testing.T) {
+	opts := NewCDPOptions(
+		WithHeadless(false),
+		WithWindowSize(1280, 800),
+		WithDevice(DevicePixel),
+		WithTimezone("Europe/Vilnius"),
+		WithLocale("lt-LT"),
+		WithGeolocation(54.68, 25.28, 0),
+		WithColorScheme("dark"),
+	)
+
+	e := opts.Emulation
+	if !e.Headful || e.Device == nil || e.Device.Name != "pixel" {
+		t.Fatalf("options were not applied: %+v", e)
+	}
+
+	if len(e.allocatorOptions()) != 5 {
+		t.Errorf("expected headful, window and lang flags, got %v", len(e.allocatorOptions()))
+	}
+
+	actions := e.actions()
+	// metrics, touch, touch events, timezone, locale, permission, geolocation, media
+	if len(actions) != 8 {
+		t.Fatalf("unexpected number of emulation actions: %v", len(actions))
+	}
+
+	metrics, ok := actions[0].(*emulation.SetDeviceMetricsOverrideParams)
+	if !ok || !metrics.Mobile || metrics.DeviceScaleFactor != DevicePixel.DeviceScaleFactor || metrics.ScreenHeight != DevicePixel.ScreenHeight {
+		t.Errorf("unexpected device metrics: %+v", actions[0])
+	}
+
+	geo, ok := actions[6].(*emulation.SetGeolocationOverrideParams)
+	if !ok || geo.Accuracy != 100 {
+		t.Errorf("geolocation accuracy should default to 100, got %+v", actions[6])
+	}
+
+	if len(Emulation{}.actions()) != 0 || len(Emulation{}.allocatorOptions()) != 0 {
+		t.Errorf("empty emulation should keep the browser defaults")
+	}
+}
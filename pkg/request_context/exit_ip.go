@@ -0,0 +1,70 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+var ErrExitIPUnchanged = errors.New("proxy changed but the exit ip is the same")
+
+// exitIPRetries is how many more proxies Reset tries when the exit ip does not change
+const exitIPRetries = 2
+
+// ExitIP loads ExitIPURL in a new tab of the session, so the request goes through the same proxy as
+// the pages do. The page has to answer with the bare address.
+func (c *CDPContext) ExitIP() (string, error) {
+	if c.exitIPURL == "" {
+		return "", errors.New("no exit ip url configured")
+	}
+
+	tab, err := c.NewTab()
+	if err != nil {
+		return "", err
+	}
+	defer tab.Close()
+
+	ctx, cancel := context.WithTimeout(tab.cdp.ctx, c.timeout)
+	defer cancel()
+
+	var body string
+	err = chromedp.Run(ctx,
+		chromedp.Navigate(c.exitIPURL),
+		chromedp.Evaluate(`document.body ? document.body.innerText : ""`, &body),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return parseExitIP(body)
+}
+
+func parseExitIP(body string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(body))
+	if ip == nil {
+		return "", errors.New("exit ip url did not answer with an ip address")
+	}
+	return ip.String(), nil
+}
+
+// verifyExitIP fails with ErrExitIPUnchanged if a proxy change kept the previous exit. Failing to
+// check is only logged, the session can still work without knowing its exit.
+func (c *CDPContext) verifyExitIP() error {
+	ip, err := c.ExitIP()
+	if err != nil {
+		c.logger.Warn("cdp", "message", "failed to check exit ip", "error", err)
+		return nil
+	}
+
+	if c.proxyChanged && ip == c.exitIP {
+		return fmt.Errorf("%w: %v", ErrExitIPUnchanged, ip)
+	}
+
+	c.logger.Debug("cdp", "message", "exit ip", "ip", ip)
+	c.exitIP = ip
+	return nil
+}
@@ -0,0 +1,17 @@
+package requestcontext
+
+import "testing"
+
+func TestParseExitIP(t *testing.T) {
+	for body, want := range map[string]string{
+		"203.0.113.7\n":        "203.0.113.7",
+		" 2001:db8::1 ":        "2001:db8::1",
+		"<html>blocked</html>": "",
+		"":                     "",
+	} {
+		got, err := parseExitIP(body)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("parseExitIP(%q) = %q, %v, want %q", body, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package requestcontext
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func jsonFilePath(dir, key string) string {
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(key, "_")+".json")
+}
+
+// readJSONFile reports false without an error if nothing was written for the key
+func readJSONFile(dir, key string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(jsonFilePath(dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, v)
+}
+
+func writeJSONFile(dir, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Written to a temp file first so that a crash does not leave a half written file
+	path := jsonFilePath(dir, key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
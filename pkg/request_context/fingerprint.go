@@ -0,0 +1,419 @@
+package requestcontext
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	util "github.com/dovydasdo/psec/util/injections"
+)
+
+// FingerprintProfile is a coherent set of values a browser exposes, everything in it has to describe
+// the same machine so that the values do not contradict each other
+type FingerprintProfile struct {
+	ID             string                  `json:"id"`
+	OS             string                  `json:"os"`
+	UserAgent      string                  `json:"userAgent"`
+	Platform       string                  `json:"platform"`
+	AcceptLanguage string                  `json:"acceptLanguage"`
+	Languages      []string                `json:"languages"`
+	Timezone       string                  `json:"timezone,omitempty"`
+	Hints          util.JsHighEntropyHints `json:"hints"`
+	Screen         Screen                  `json:"screen"`
+	// Navigator holds the plain navigator values of the emulator data
+	Navigator         map[string]interface{} `json:"navigator,omitempty"`
+	DeviceScaleFactor float64                `json:"deviceScaleFactor"`
+	// HardwareConcurrency is the number of logical cores
+	HardwareConcurrency int `json:"hardwareConcurrency"`
+	// DeviceMemory is in gigabytes, browsers report at most 8
+	DeviceMemory  int       `json:"deviceMemory"`
+	WebGLVendor   string    `json:"webglVendor"`
+	WebGLRenderer string    `json:"webglRenderer"`
+	Created       time.Time `json:"created"`
+}
+
+type Screen struct {
+	Width       int64 `json:"width"`
+	Height      int64 `json:"height"`
+	AvailWidth  int64 `json:"availWidth"`
+	AvailHeight int64 `json:"availHeight"`
+	ColorDepth  int64 `json:"colorDepth"`
+	PixelDepth  int64 `json:"pixelDepth"`
+}
+
+type webGL struct {
+	vendor   string
+	renderer string
+}
+
+// hardwarePool holds the values real machines of a platform have, keyed by the client hint platform
+type hardwarePool struct {
+	screens []Screen
+	cores   []int
+	memory  []int
+	webgl   []webGL
+	// taskbar is how much of the screen height the os takes
+	taskbar int64
+	scales  []float64
+}
+
+var hardwarePools = map[string]hardwarePool{
+	"Windows": {
+		screens: []Screen{
+			{Width: 1920, Height: 1080},
+			{Width: 1366, Height: 768},
+			{Width: 1536, Height: 864},
+			{Width: 2560, Height: 1440},
+			{Width: 1600, Height: 900},
+		},
+		cores:  []int{4, 6, 8, 12, 16},
+		memory: []int{4, 8},
+		webgl: []webGL{
+			{"Google Inc. (NVIDIA)", "ANGLE (NVIDIA, NVIDIA GeForce GTX 1650 Direct3D11 vs_5_0 ps_5_0, D3D11)"},
+			{"Google Inc. (NVIDIA)", "ANGLE (NVIDIA, NVIDIA GeForce RTX 3060 Direct3D11 vs_5_0 ps_5_0, D3D11)"},
+			{"Google Inc. (Intel)", "ANGLE (Intel, Intel(R) UHD Graphics 620 Direct3D11 vs_5_0 ps_5_0, D3D11)"},
+			{"Google Inc. (Intel)", "ANGLE (Intel, Intel(R) Iris(R) Xe Graphics Direct3D11 vs_5_0 ps_5_0, D3D11)"},
+			{"Google Inc. (AMD)", "ANGLE (AMD, AMD Radeon RX 580 Series Direct3D11 vs_5_0 ps_5_0, D3D11)"},
+		},
+		taskbar: 40,
+		scales:  []float64{1, 1, 1.25, 1.5},
+	},
+	"macOS": {
+		screens: []Screen{
+			{Width: 1440, Height: 900},
+			{Width: 1512, Height: 982},
+			{Width: 1728, Height: 1117},
+			{Width: 1920, Height: 1080},
+		},
+		cores:  []int{8, 10, 12},
+		memory: []int{8},
+		webgl: []webGL{
+			{"Google Inc. (Apple)", "ANGLE (Apple, Apple M1, OpenGL 4.1)"},
+			{"Google Inc. (Apple)", "ANGLE (Apple, Apple M2, OpenGL 4.1)"},
+			{"Google Inc. (Apple)", "ANGLE (Apple, Apple M1 Pro, OpenGL 4.1)"},
+		},
+		taskbar: 25,
+		scales:  []float64{2},
+	},
+	"Linux": {
+		screens: []Screen{
+			{Width: 1920, Height: 1080},
+			{Width: 2560, Height: 1440},
+			{Width: 1366, Height: 768},
+		},
+		cores:  []int{4, 8, 12, 16},
+		memory: []int{8},
+		webgl: []webGL{
+			{"Google Inc. (Intel)", "ANGLE (Intel, Mesa Intel(R) UHD Graphics 620 (KBL GT2), OpenGL 4.6)"},
+			{"Google Inc. (NVIDIA Corporation)", "ANGLE (NVIDIA Corporation, NVIDIA GeForce GTX 1060 6GB/PCIe/SSE2, OpenGL 4.5.0)"},
+			{"Google Inc. (AMD)", "ANGLE (AMD, AMD Radeon RX 6600 (navi23, LLVM 15.0.7, DRM 3.49, 6.2.0), OpenGL 4.6)"},
+		},
+		taskbar: 27,
+		scales:  []float64{1},
+	},
+	"Android": {
+		screens: []Screen{
+			{Width: 412, Height: 915},
+			{Width: 393, Height: 873},
+			{Width: 360, Height: 800},
+		},
+		cores:  []int{8},
+		memory: []int{4, 8},
+		webgl: []webGL{
+			{"Qualcomm", "Adreno (TM) 730"},
+			{"Qualcomm", "Adreno (TM) 650"},
+			{"ARM", "Mali-G78"},
+		},
+		scales: []float64{2.625, 2.75, 3},
+	},
+}
+
+// GenerateProfile picks hardware matching the platform of the user agent data
+func GenerateProfile(info util.UserAgentInfo, rnd *rand.Rand) *FingerprintProfile {
+	hints := info.Metadata.JsHighEntropyHints
+
+	pool, ok := hardwarePools[hints.Platform]
+	if !ok {
+		pool = hardwarePools["Windows"]
+	}
+
+	screen := pool.screens[rnd.Intn(len(pool.screens))]
+	screen.AvailWidth = screen.Width
+	screen.AvailHeight = screen.Height - pool.taskbar
+	screen.ColorDepth = 24
+	screen.PixelDepth = 24
+
+	gl := pool.webgl[rnd.Intn(len(pool.webgl))]
+
+	id := make([]byte, 8)
+	rnd.Read(id)
+
+	return &FingerprintProfile{
+		ID:                  hex.EncodeToString(id),
+		OS:                  info.OS,
+		UserAgent:           info.UserAgent,
+		Platform:            info.Platform,
+		AcceptLanguage:      info.AcceptLanguage,
+		Languages:           languages(info.AcceptLanguage),
+		Hints:               hints,
+		Screen:              screen,
+		Navigator:           info.Navigator,
+		DeviceScaleFactor:   pool.scales[rnd.Intn(len(pool.scales))],
+		HardwareConcurrency: pool.cores[rnd.Intn(len(pool.cores))],
+		DeviceMemory:        pool.memory[rnd.Intn(len(pool.memory))],
+		WebGLVendor:         gl.vendor,
+		WebGLRenderer:       gl.renderer,
+		Timezone:            timezoneFor(localeCountry(info.AcceptLanguage), rnd),
+		Created:             time.Now(),
+	}
+}
+
+// languages turns an Accept-Language value into navigator.languages, en-US also gets en after it
+func languages(acceptLanguage string) []string {
+	langs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(lang string) {
+		if lang != "" && !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		lang := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		add(lang)
+		if base, _, found := strings.Cut(lang, "-"); found {
+			add(base)
+		}
+	}
+
+	if len(langs) == 0 {
+		langs = append(langs, "en-US", "en")
+	}
+
+	return langs
+}
+
+func (p *FingerprintProfile) userAgentOverride() *emulation.SetUserAgentOverrideParams {
+	override := emulation.SetUserAgentOverride(p.UserAgent)
+	override.AcceptLanguage = p.AcceptLanguage
+	override.Platform = p.Platform
+
+	brands := make([]*emulation.UserAgentBrandVersion, 0, len(p.Hints.Brands))
+	for _, brand := range p.Hints.Brands {
+		brands = append(brands, &emulation.UserAgentBrandVersion{Brand: brand.Brand, Version: brand.Version})
+	}
+
+	fullVersions := make([]*emulation.UserAgentBrandVersion, 0, len(p.Hints.FullVersionList))
+	for _, brand := range p.Hints.FullVersionList {
+		fullVersions = append(fullVersions, &emulation.UserAgentBrandVersion{Brand: brand.Brand, Version: brand.Version})
+	}
+
+	override.UserAgentMetadata = &emulation.UserAgentMetadata{
+		Architecture:    p.Hints.Architecture,
+		Bitness:         p.Hints.Bitness,
+		Mobile:          p.Hints.Mobile,
+		Model:           p.Hints.Model,
+		Platform:        p.Hints.Platform,
+		PlatformVersion: p.Hints.PlatformVersion,
+		Wow64:           p.Hints.Wow64,
+		Brands:          brands,
+		FullVersionList: fullVersions,
+	}
+
+	return override
+}
+
+// profileScript runs in the stealth bundle after its modules, utils comes from there
+const profileScript = `const p = %s;
+const define = (obj, prop, value) => {
+	try {
+		utils.replaceGetter(obj, prop, function () { return value; });
+	} catch (e) {}
+};
+
+// The user agent comes from the override, webdriver is left to the stealth injection
+const skip = ['userAgent', 'appVersion', 'webdriver'];
+for (const [key, value] of Object.entries(p.navigator || {})) {
+	if (!skip.includes(key)) define(Navigator.prototype, key, value);
+}
+
+define(Navigator.prototype, 'hardwareConcurrency', p.hardwareConcurrency);
+define(Navigator.prototype, 'deviceMemory', p.deviceMemory);
+define(Navigator.prototype, 'languages', Object.freeze(p.languages.slice()));
+define(Navigator.prototype, 'language', p.languages[0]);
+define(Navigator.prototype, 'platform', p.platform);
+
+for (const [key, value] of Object.entries(p.screen)) {
+	define(Screen.prototype, key, value);
+}
+
+const patch = (proto) => {
+	const original = proto.getParameter;
+	proto.getParameter = utils.makeNative(function getParameter(param) {
+		if (param === 37445) return p.webglVendor;
+		if (param === 37446) return p.webglRenderer;
+		return original.apply(this, arguments);
+	});
+};
+if (window.WebGLRenderingContext) patch(WebGLRenderingContext.prototype);
+if (window.WebGL2RenderingContext) patch(WebGL2RenderingContext.prototype);`
+
+// device is the viewport of mobile profiles, desktop ones keep the window size
+func (p *FingerprintProfile) device() *Device {
+	if !p.Hints.Mobile {
+		return nil
+	}
+
+	return &Device{
+		Name:              p.OS,
+		Width:             p.Screen.Width,
+		Height:            p.Screen.AvailHeight,
+		ScreenWidth:       p.Screen.Width,
+		ScreenHeight:      p.Screen.Height,
+		DeviceScaleFactor: p.DeviceScaleFactor,
+		Mobile:            true,
+		Touch:             true,
+	}
+}
+
+// script overrides the values that have no emulation command, it is bundled after the stealth modules
+func (p *FingerprintProfile) script() (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(profileScript, data), nil
+}
+
+// ProfileStore keeps profiles by proxy identity, Load returns nil without an error if there is none
+type ProfileStore interface {
+	Load(key string) (*FingerprintProfile, error)
+	Save(key string, profile *FingerprintProfile) error
+}
+
+type FileProfileStore struct {
+	Dir string
+}
+
+func NewFileProfileStore(dir string) *FileProfileStore {
+	return &FileProfileStore{Dir: dir}
+}
+
+func (s *FileProfileStore) Load(key string) (*FingerprintProfile, error) {
+	profile := &FingerprintProfile{}
+	found, err := readJSONFile(s.Dir, key, profile)
+	if !found || err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *FileProfileStore) Save(key string, profile *FingerprintProfile) error {
+	return writeJSONFile(s.Dir, key, profile)
+}
+
+// defaultProfileKey is used when the proxy agent has no identity
+const defaultProfileKey = "default"
+
+// resolveProfile picks the profile for the current proxy identity: the one already in use, a stored one
+// or a newly generated one. After ChangeProxy a new profile is generated if the identity is unknown.
+func (c *CDPContext) resolveProfile() error {
+	if c.fixedProfile != nil {
+		c.profile = c.fixedProfile
+		return c.checkProfileVersion(c.profile)
+	}
+
+	key := defaultProfileKey
+	if identifier, ok := c.ProxyAgent.(ProxyIdentifier); ok && identifier.ProxyID() != "" {
+		key = identifier.ProxyID()
+	}
+
+	if c.profile != nil && c.profileKey == key && !c.rotateProfile && c.matchesVersion(c.profile) {
+		return nil
+	}
+
+	// A new identity gets its own profile even without an explicit rotation
+	rotate := c.rotateProfile && key == c.profileKey
+	c.rotateProfile = false
+	c.profileKey = key
+
+	if c.profileStore != nil && !rotate {
+		profile, err := c.profileStore.Load(key)
+		if err != nil {
+			c.logger.Warn("cdp", "message", "failed to load fingerprint profile, generating", "key", key, "error", err)
+		}
+
+		// Profiles for another browser version are replaced, the binary might have been updated
+		if profile != nil && c.matchesVersion(profile) {
+			c.profile = profile
+			return nil
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	os := util.PickOS(c.osProfiles, rnd)
+	version := c.profileVersion()
+	info, err := util.GetOSUAInfo(c.emulatorData, version, os)
+	if err != nil {
+		c.logger.Warn("cdp", "message", "failed to get user agent data, fallback data will be used", "os", os.Name, "version", version, "error", err)
+	}
+
+	if c.emulation.Locale != "" {
+		info.AcceptLanguage = c.emulation.Locale
+	}
+
+	profile := GenerateProfile(info, rnd)
+	if err := c.checkProfileVersion(profile); err != nil {
+		return err
+	}
+
+	// The exit of the proxy tells more about where the visitor is than the language does
+	if locator, ok := c.ProxyAgent.(ProxyLocator); ok {
+		if timezone := timezoneFor(locator.ProxyCountry(), rnd); timezone != "" {
+			profile.Timezone = timezone
+		}
+	}
+
+	c.profile = profile
+	c.logger.Debug("cdp", "message", "generated fingerprint profile", "id", c.profile.ID, "os", c.profile.OS, "key", key)
+
+	if c.profileStore != nil {
+		return c.profileStore.Save(key, c.profile)
+	}
+
+	return nil
+}
+
+// matchesVersion accepts a profile for another version in VERSION_MATCH_WARN mode if there is no
+// data for the wanted one, a new profile would fall back to other data all the same
+func (c *CDPContext) matchesVersion(profile *FingerprintProfile) bool {
+	want := c.profileVersion()
+	if want == 0 {
+		return true
+	}
+
+	got, err := majorVersion(profile.Hints.UaFullVersion)
+	if err == nil && got == want {
+		return true
+	}
+
+	return c.versionMatch == VERSION_MATCH_WARN && !c.hasVersionData(want, profile.OS)
+}
+
+func (c *CDPContext) hasVersionData(version int, osName string) bool {
+	os, err := util.GetOSProfile(osName)
+	if err != nil {
+		os = util.OSProfiles[0]
+	}
+
+	_, err = util.GetInfo(c.emulatorData, version, os, "en-US")
+	return err == nil
+}
@@ -0,0 +1,171 @@
+package requestcontext
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	util "github.com/dovydasdo/psec/util/injections"
+)
+
+type testProxyAgent struct {
+	id string
+}
+
+func (a *testProxyAgent) LoadProxies() error           { return nil }
+func (a *testProxyAgent) SetProxy() error              { return nil }
+func (a *testProxyAgent) GetAuth() (*ProxyAuth, error) { return nil, nil }
+func (a *testProxyAgent) ProxyID() string              { return a.id }
+
+func TestGenerateProfile(t *testing.T) {
+	info := util.GetStaticUAInfo()
+	info.AcceptLanguage = "lt-LT,en-US;q=0.8"
+
+	profile := GenerateProfile(info, rand.New(rand.NewSource(1)))
+
+	if profile.UserAgent != info.UserAgent || profile.Hints.Platform != "Windows" {
+		t.Errorf("user agent data was not kept: %+v", profile)
+	}
+
+	if !reflect.DeepEqual(profile.Languages, []string{"lt-LT", "lt", "en-US", "en"}) {
+		t.Errorf("unexpected languages: %v", profile.Languages)
+	}
+
+	if profile.Screen.AvailHeight >= profile.Screen.Height || profile.Screen.ColorDepth != 24 {
+		t.Errorf("unexpected screen: %+v", profile.Screen)
+	}
+
+	if profile.HardwareConcurrency == 0 || profile.DeviceMemory == 0 || profile.WebGLRenderer == "" {
+		t.Errorf("hardware was not picked: %+v", profile)
+	}
+
+	if profile.Timezone != "Europe/Vilnius" {
+		t.Errorf("timezone does not match the locale: %v", profile.Timezone)
+	}
+
+	if _, err := profile.script(); err != nil {
+		t.Errorf("failed to build script: %v", err)
+	}
+}
+
+func TestUserAgentOverride(t *testing.T) {
+	info := util.GetStaticUAInfo()
+	info.Metadata.JsHighEntropyHints.Brands = info.Metadata.JsHighEntropyHints.Brands[:1]
+	info.Metadata.JsHighEntropyHints.FullVersionList = nil
+
+	override := GenerateProfile(info, rand.New(rand.NewSource(1))).userAgentOverride()
+
+	if len(override.UserAgentMetadata.Brands) != 1 || len(override.UserAgentMetadata.FullVersionList) != 0 {
+		t.Errorf("brands were not copied as received: %+v", override.UserAgentMetadata)
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	agent := &testProxyAgent{id: "10.0.0.1"}
+
+	c := GetCDPContext(NewCDPOptions(WithProfileStore(NewFileProfileStore(t.TempDir()))))
+	c.ProxyAgent = agent
+
+	if err := c.resolveProfile(); err != nil {
+		t.Fatalf("failed to resolve profile: %v", err)
+	}
+	first := c.Profile()
+
+	agent.id = "10.0.0.2"
+	c.ChangeProxy()
+	c.resolveProfile()
+	second := c.Profile()
+
+	if second.ID == first.ID {
+		t.Errorf("profile was not rotated with the proxy")
+	}
+
+	agent.id = "10.0.0.1"
+	c.ChangeProxy()
+	c.resolveProfile()
+
+	if c.Profile().ID != first.ID {
+		t.Errorf("profile bound to the proxy was not restored from the store")
+	}
+
+	// Same identity, the rotation has to generate a new one
+	c.ChangeProxy()
+	c.resolveProfile()
+
+	if c.Profile().ID == first.ID {
+		t.Errorf("profile was not rotated for the same identity")
+	}
+}
+
+func TestProfileOS(t *testing.T) {
+	c := GetCDPContext(NewCDPOptions(WithOS("android"), WithBrowserVersion(118)))
+
+	if err := c.resolveProfile(); err != nil {
+		t.Fatalf("failed to resolve profile: %v", err)
+	}
+
+	profile := c.Profile()
+	if profile.OS != "android" || !profile.Hints.Mobile || profile.Hints.Platform != "Android" {
+		t.Fatalf("android profile was not used: %+v", profile)
+	}
+
+	if profile.Navigator["vendor"] != "Google Inc." {
+		t.Errorf("navigator data was not kept: %v", profile.Navigator)
+	}
+
+	device := profile.device()
+	if device == nil || !device.Touch || device.DeviceScaleFactor < 2 {
+		t.Errorf("mobile profile should emulate a touch device: %+v", device)
+	}
+
+	desktop := GenerateProfile(util.GetStaticUAInfo(), rand.New(rand.NewSource(1)))
+	if desktop.device() != nil {
+		t.Errorf("desktop profile should keep the window size")
+	}
+}
+
+func TestVersionMatch(t *testing.T) {
+	for in, want := range map[string]int{
+		"HeadlessChrome/118.0.5993.70": 118,
+		"Chrome/120.0.6099.109":        120,
+		"117.0.5938.149":               117,
+	} {
+		got, err := majorVersion(in)
+		if err != nil || got != want {
+			t.Errorf("majorVersion(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+
+	c := GetCDPContext(NewCDPOptions(WithProfileStore(NewFileProfileStore(t.TempDir()))))
+	c.ProxyAgent = &testProxyAgent{id: "10.0.0.1"}
+	c.detectedVersion = 118
+
+	if err := c.resolveProfile(); err != nil {
+		t.Fatalf("failed to resolve profile for a known version: %v", err)
+	}
+	if got, _ := majorVersion(c.Profile().Hints.UaFullVersion); got != 118 {
+		t.Errorf("profile is for version %v, want 118", got)
+	}
+
+	// There is no data for the version, the profile is kept instead of generating one that falls back
+	// to other data on every Initialize
+	id := c.Profile().ID
+	c.detectedVersion = 1
+	if err := c.resolveProfile(); err != nil {
+		t.Errorf("version mismatch should only warn: %v", err)
+	}
+	if c.Profile().ID != id {
+		t.Errorf("profile was replaced although there is no data for the browser version")
+	}
+
+	c.profile = nil
+	if err := c.resolveProfile(); err != nil || c.Profile().ID != id {
+		t.Errorf("stored profile was not kept for a version without data: %v", err)
+	}
+
+	c.versionMatch = VERSION_MATCH_FAIL
+	c.profile = nil
+	if err := c.resolveProfile(); err == nil {
+		t.Errorf("expected an error for a version without data")
+	}
+}
@@ -0,0 +1,93 @@
+package requestcontext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	forwardproxy "github.com/dovydasdo/psec/pkg/forward_proxy"
+)
+
+// startForwarder runs the local proxy the sessions of a launched browser point at. Remote browsers
+// can not reach it, they get the server of the agent directly.
+func (c *CDPContext) startForwarder() error {
+	if !c.forwardProxy || c.remoteURL != "" {
+		return nil
+	}
+
+	// Other local processes could use the upstream through the forwarder, only the browser knows these
+	auth := &ProxyAuth{}
+	for _, value := range []*string{&auth.Username, &auth.Password} {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		*value = hex.EncodeToString(secret)
+	}
+
+	forwarder := forwardproxy.New(forwardproxy.NewOptions(
+		forwardproxy.WithUpstream(c.currentUpstream),
+		forwardproxy.WithCredentials(auth.Username, auth.Password),
+		forwardproxy.WithLogger(c.logger),
+	))
+	if err := forwarder.Start(); err != nil {
+		return err
+	}
+
+	c.forwarder, c.forwardAuth = forwarder, auth
+	return nil
+}
+
+// proxyAuth answers the proxy challenges of the browser, with the forwarder it is the only proxy the browser sees
+func (c *CDPContext) proxyAuth() (*ProxyAuth, error) {
+	if auth := c.root().forwardAuth; auth != nil {
+		return auth, nil
+	}
+	return c.ProxyAgent.GetAuth()
+}
+
+func (c *CDPContext) currentUpstream() (*forwardproxy.Upstream, error) {
+	c.upstreamMu.Lock()
+	defer c.upstreamMu.Unlock()
+
+	return c.upstream, nil
+}
+
+// RefreshUpstream reads the proxy of the agent again. With the forwarding proxy new connections use
+// it right away, without a Reset; open ones stay on the previous upstream until they are closed.
+func (c *CDPContext) RefreshUpstream() error {
+	var upstream *forwardproxy.Upstream
+
+	if endpoint, ok := c.ProxyAgent.(ProxyEndpoint); ok {
+		parsed, err := forwardproxy.ParseUpstream(endpoint.ProxyServer())
+		if err != nil {
+			return err
+		}
+
+		auth, err := c.ProxyAgent.GetAuth()
+		if err != nil {
+			return err
+		}
+		if auth != nil {
+			parsed.Username = auth.Username
+			parsed.Password = auth.Password
+		}
+
+		upstream = parsed
+	}
+
+	c.upstreamMu.Lock()
+	c.upstream = upstream
+	c.upstreamMu.Unlock()
+
+	c.logger.Debug("cdp", "message", "upstream set", "upstream", upstream.Key())
+	return nil
+}
+
+// Traffic returns the bytes sent and received through every upstream since the browser was launched,
+// it is only counted with the forwarding proxy
+func (c *CDPContext) Traffic() map[string]forwardproxy.Traffic {
+	if c.forwarder == nil {
+		return nil
+	}
+	return c.forwarder.Traffic()
+}
@@ -0,0 +1,61 @@
+package requestcontext
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestForwarderUpstream(t *testing.T) {
+	agent := NewBDProxyAgent(NewBDProxyOptions(
+		WithServer("127.0.0.1:22225"),
+		WithUsername("customer"),
+		WithPassword("secret"),
+	))
+
+	c := GetCDPContext(NewCDPOptions())
+	c.RegisterProxyAgent(agent)
+
+	if err := c.startForwarder(); err != nil {
+		t.Fatalf("failed to start forwarder: %v", err)
+	}
+	defer c.closeBrowser()
+
+	if !strings.HasPrefix(c.proxyServer(), "http://127.0.0.1:") || c.proxyServer() == agent.ProxyServer() {
+		t.Errorf("sessions should point at the forwarder, got %v", c.proxyServer())
+	}
+
+	auth, err := c.proxyAuth()
+	if err != nil || auth.Username == "" || auth.Password == "" || auth.Username == "customer" {
+		t.Errorf("browser should answer with the credentials of the forwarder, got %+v", auth)
+	}
+
+	resp, err := http.Get(c.proxyServer() + "/")
+	if err != nil {
+		t.Fatalf("failed to reach the forwarder: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("forwarder let in a client without credentials: %v", resp.Status)
+	}
+
+	c.ChangeProxy()
+	if err := c.RefreshUpstream(); err != nil {
+		t.Fatalf("failed to refresh upstream: %v", err)
+	}
+
+	upstream, _ := c.currentUpstream()
+	if upstream.Key() != "http://customer-session-1@127.0.0.1:22225" || upstream.Password != "secret" {
+		t.Errorf("unexpected upstream: %v", upstream.Key())
+	}
+
+	if c.Traffic() == nil {
+		t.Errorf("expected traffic stats with the forwarder")
+	}
+
+	remote := GetCDPContext(NewCDPOptions(WithRemoteURL("ws://127.0.0.1:9222")))
+	remote.startForwarder()
+	if remote.forwarder != nil {
+		t.Errorf("remote browsers can not use the forwarder")
+	}
+}
@@ -0,0 +1,292 @@
+package requestcontext
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 as described in http://www.softwareishard.com/blog/har-12-spec/
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	FromCache       bool        `json:"_fromCache,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings are in milliseconds, -1 marks a phase that does not apply or is unknown
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HAR builds an archive from the captured network events ordered by the time they were sent
+func (s *State) HAR() *HAR {
+	events := make([]*NetworkEvent, 0)
+	s.NetworkEvents.Range(func(key, value interface{}) bool {
+		if ev, ok := value.(*NetworkEvent); ok {
+			events = append(events, ev)
+		}
+		return true
+	})
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Request.Time.Before(events[j].Request.Time)
+	})
+
+	entries := make([]HAREntry, 0, len(events))
+	for _, ev := range events {
+		entries = append(entries, harEntry(ev))
+	}
+
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "psec", Version: "dev"},
+			Entries: entries,
+		},
+	}
+}
+
+func (s *State) WriteHAR(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.HAR())
+}
+
+func harEntry(ev *NetworkEvent) HAREntry {
+	entry := HAREntry{
+		StartedDateTime: ev.Request.Time.Format(time.RFC3339Nano),
+		Request: HARRequest{
+			Method:      ev.Request.Method,
+			URL:         ev.Request.URL,
+			HTTPVersion: harHTTPVersion(ev.Response.Protocol),
+			Cookies:     make([]HARNameValue, 0),
+			Headers:     harHeaders(ev.Request.Headers),
+			QueryString: harQuery(ev.Request.URL),
+			HeadersSize: -1,
+			BodySize:    len(ev.Request.Body),
+		},
+		Response: HARResponse{
+			Status:      ev.Response.Status,
+			StatusText:  ev.Response.StatusText,
+			HTTPVersion: harHTTPVersion(ev.Response.Protocol),
+			Cookies:     make([]HARNameValue, 0),
+			Headers:     harHeaders(ev.Response.Headers),
+			Content:     harContent(ev.Response),
+			RedirectURL: headerValue(ev.Response.Headers, "Location"),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings:         HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+		ServerIPAddress: ev.Response.RemoteIP,
+		FromCache:       ev.Response.FromCache,
+	}
+
+	if ev.Response.EncodedDataLength > 0 {
+		entry.Response.BodySize = int(ev.Response.EncodedDataLength)
+	}
+
+	if ev.Request.Body != "" {
+		entry.Request.PostData = &HARPostData{
+			MimeType: headerValue(ev.Request.Headers, "Content-Type"),
+			Text:     ev.Request.Body,
+		}
+	}
+
+	if ev.Timing.RequestTime > 0 {
+		entry.Timings = harTimings(ev.Timing)
+	} else if !ev.Response.Time.IsZero() && !ev.Request.Time.IsZero() {
+		entry.Timings.Wait = milliseconds(ev.Response.Time.Sub(ev.Request.Time))
+	}
+
+	// ssl is already a part of connect
+	for _, phase := range []float64{entry.Timings.Blocked, entry.Timings.DNS, entry.Timings.Connect, entry.Timings.Send, entry.Timings.Wait, entry.Timings.Receive} {
+		if phase > 0 {
+			entry.Time += phase
+		}
+	}
+
+	return entry
+}
+
+// harTimings maps the browser timing to har phases the same way devtools does
+func harTimings(t NetworkTiming) HARTimings {
+	timings := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+
+	for _, start := range []float64{t.DNSStart, t.ConnectStart, t.SendStart} {
+		if start >= 0 {
+			timings.Blocked = start
+			break
+		}
+	}
+
+	if t.DNSStart >= 0 {
+		timings.DNS = t.DNSEnd - t.DNSStart
+	}
+
+	if t.ConnectStart >= 0 {
+		timings.Connect = t.ConnectEnd - t.ConnectStart
+	}
+
+	if t.SSLStart >= 0 {
+		timings.SSL = t.SSLEnd - t.SSLStart
+	}
+
+	timings.Send = math.Max(t.SendEnd-t.SendStart, 0)
+	timings.Wait = math.Max(t.ReceiveHeadersEnd-t.SendEnd, 0)
+
+	if t.LoadingFinished > 0 {
+		timings.Receive = math.Max(t.LoadingFinished-t.ReceiveHeadersEnd, 0)
+	}
+
+	return timings
+}
+
+func harHTTPVersion(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "":
+		return ""
+	case "h2":
+		return "HTTP/2.0"
+	case "h3", "h3-29":
+		return "HTTP/3.0"
+	default:
+		return strings.ToUpper(protocol)
+	}
+}
+
+func harContent(resp NetworkResponse) HARContent {
+	content := HARContent{
+		Size:     len(resp.Body),
+		MimeType: resp.MimeType,
+	}
+
+	if !resp.Base64Encoded && utf8.Valid(resp.Body) {
+		content.Text = string(resp.Body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(resp.Body)
+		content.Encoding = "base64"
+	}
+
+	return content
+}
+
+func harHeaders(headers map[string]string) []HARNameValue {
+	values := make([]HARNameValue, 0, len(headers))
+	for name, value := range headers {
+		values = append(values, HARNameValue{Name: name, Value: value})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+
+	return values
+}
+
+func harQuery(rawURL string) []HARNameValue {
+	values := make([]HARNameValue, 0)
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+
+	for name, vals := range u.Query() {
+		for _, value := range vals {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+
+	return values
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for hName, value := range headers {
+		if strings.EqualFold(hName, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
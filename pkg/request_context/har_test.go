@@ -0,0 +1,123 @@
+package requestcontext
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHAR(t *testing.T) {
+	state := &State{}
+	sent := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	state.NetworkEvents.Store("2", &NetworkEvent{
+		Request: NetworkRequest{
+			URL:     "https://example.com/api?page=2&sort=asc",
+			Method:  "POST",
+			Body:    `{"q":"test"}`,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Time:    sent.Add(time.Second),
+		},
+		Response: NetworkResponse{
+			URL:      "https://example.com/api?page=2&sort=asc",
+			Status:   201,
+			MimeType: "application/json",
+			Body:     []byte(`{"ok":true}`),
+			Headers:  map[string]string{"content-type": "application/json"},
+			Protocol: "h2",
+			RemoteIP: "93.184.216.34",
+			Time:     sent.Add(time.Second + 150*time.Millisecond),
+		},
+		Timing: NetworkTiming{
+			RequestTime:       1000,
+			DNSStart:          5,
+			DNSEnd:            15,
+			ConnectStart:      15,
+			ConnectEnd:        60,
+			SSLStart:          30,
+			SSLEnd:            60,
+			SendStart:         60,
+			SendEnd:           62,
+			ReceiveHeadersEnd: 140,
+			LoadingFinished:   150,
+		},
+	})
+
+	state.NetworkEvents.Store("1", &NetworkEvent{
+		Request: NetworkRequest{
+			URL:    "https://example.com/logo.png",
+			Method: "GET",
+			Time:   sent,
+		},
+		Response: NetworkResponse{
+			URL:      "https://example.com/logo.png",
+			Status:   200,
+			MimeType: "image/png",
+			Body:     []byte("\x89PNG\r\n\x1a\n\xff"),
+		},
+	})
+
+	har := state.HAR()
+
+	if har.Log.Version != "1.2" {
+		t.Errorf("unexpected har version: %v", har.Log.Version)
+	}
+
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", len(har.Log.Entries))
+	}
+
+	image := har.Log.Entries[0]
+	if image.Request.URL != "https://example.com/logo.png" {
+		t.Errorf("entries are not ordered by start time")
+	}
+
+	if image.Response.Content.Encoding != "base64" || image.Response.Content.Text != "iVBORw0KGgr/" {
+		t.Errorf("binary body was not base64 encoded: %+v", image.Response.Content)
+	}
+
+	api := har.Log.Entries[1]
+	if api.Request.Method != "POST" || api.Response.Status != 201 {
+		t.Errorf("unexpected method or status: %v %v", api.Request.Method, api.Response.Status)
+	}
+
+	if api.Request.PostData == nil || api.Request.PostData.MimeType != "application/json" {
+		t.Errorf("post data was not exported: %+v", api.Request.PostData)
+	}
+
+	if len(api.Request.QueryString) != 2 || api.Request.QueryString[0].Name != "page" {
+		t.Errorf("unexpected query string: %+v", api.Request.QueryString)
+	}
+
+	if api.Time != 150 {
+		t.Errorf("unexpected entry time: %v", api.Time)
+	}
+
+	expected := HARTimings{Blocked: 5, DNS: 10, Connect: 45, SSL: 30, Send: 2, Wait: 78, Receive: 10}
+	if api.Timings != expected {
+		t.Errorf("unexpected timings: %+v", api.Timings)
+	}
+
+	if api.Response.HTTPVersion != "HTTP/2.0" || api.ServerIPAddress != "93.184.216.34" {
+		t.Errorf("protocol or remote ip were not exported")
+	}
+
+	if image.Timings.Wait != 0 || image.Time != 0 {
+		t.Errorf("entry without a response time should not have timings: %+v", image.Timings)
+	}
+
+	var buf bytes.Buffer
+	if err := state.WriteHAR(&buf); err != nil {
+		t.Fatalf("failed to write har: %v", err)
+	}
+
+	decoded := HAR{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("written har is not valid json: %v", err)
+	}
+
+	if len(decoded.Log.Entries) != 2 {
+		t.Errorf("written har lost entries")
+	}
+}
@@ -0,0 +1,382 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+// HTTPContext loads pages without a browser, for endpoints that do not need js. Requests go out with
+// the tls and http2 fingerprint of Chrome, cookies are kept until Reset. It has no page, so instructions
+// that need one are not supported and done conditions are met as soon as the response is read.
+type HTTPContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	client *req.Client
+
+	timeout       time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	userAgent     string
+	headers       map[string]string
+	registry      *Registry
+	blockDetector BlockDetector
+	logger        *slog.Logger
+
+	State      *State
+	ProxyAgent ProxyGetter
+
+	events     int64
+	documentMu sync.Mutex
+	document   *NetworkEvent
+}
+
+func GetHTTPContext(options *HTTPOptions) *HTTPContext {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultInstructionTimeout
+	}
+
+	registry := options.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &HTTPContext{
+		State:         &State{},
+		timeout:       timeout,
+		retries:       options.Retries,
+		retryBackoff:  options.RetryBackoff,
+		userAgent:     options.UserAgent,
+		headers:       options.Headers,
+		registry:      registry,
+		blockDetector: options.BlockDetector,
+		logger:        logger,
+	}
+}
+
+func (c *HTTPContext) Initialize() error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	client := req.C().
+		ImpersonateChrome().
+		SetCookieJar(jar).
+		SetCommonRetryCount(c.retries).
+		SetCommonRetryBackoffInterval(c.retryBackoff, c.retryBackoff*10).
+		SetCommonRetryCondition(func(resp *req.Response, err error) bool {
+			return err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		}).
+		// The proxy is read for every request, so ChangeProxy applies without a new client
+		SetProxy(func(*http.Request) (*url.URL, error) {
+			return c.proxyURL()
+		})
+
+	if c.userAgent != "" {
+		client.SetUserAgent(c.userAgent)
+	}
+	if len(c.headers) > 0 {
+		client.SetCommonHeaders(c.headers)
+	}
+
+	client.GetTransport().WrapRoundTripFunc(func(rt http.RoundTripper) req.HttpRoundTripFunc {
+		return func(r *http.Request) (*http.Response, error) {
+			return c.capture(rt, r)
+		}
+	})
+
+	c.client = client
+	return nil
+}
+
+// proxyURL is the server of the agent with its auth, nil connects directly
+func (c *HTTPContext) proxyURL() (*url.URL, error) {
+	endpoint, ok := c.ProxyAgent.(ProxyEndpoint)
+	if !ok {
+		return nil, nil
+	}
+
+	server := endpoint.ProxyServer()
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+
+	proxyURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := c.ProxyAgent.GetAuth()
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil && auth.Username != "" {
+		proxyURL.User = url.UserPassword(auth.Username, auth.Password)
+	}
+
+	return proxyURL, nil
+}
+
+// capture records every request that goes out, redirects and retries included. Bodies are only read
+// by the instructions, they are added to the event of the final response.
+func (c *HTTPContext) capture(rt http.RoundTripper, r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	event := &NetworkEvent{
+		Request: NetworkRequest{
+			URL:     r.URL.String(),
+			Method:  r.Method,
+			Headers: flattenHeaders(r.Header),
+			Type:    typeFromContext(r.Context()),
+			Time:    start,
+		},
+		Timing: NetworkTiming{
+			RequestTime: float64(start.UnixNano()) / float64(time.Second),
+			ProxyStart:  -1, ProxyEnd: -1, DNSStart: -1, DNSEnd: -1, ConnectStart: -1, ConnectEnd: -1,
+			SSLStart: -1, SSLEnd: -1, WorkerStart: -1, WorkerReady: -1, PushStart: -1, PushEnd: -1,
+			ReceiveHeadersStart: -1, LoadingFinished: -1,
+		},
+	}
+
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			event.Request.Body = string(data)
+		}
+	}
+
+	c.State.NetworkEvents.Store(strconv.FormatInt(atomic.AddInt64(&c.events, 1), 10), event)
+
+	resp, err := rt.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	received := time.Now()
+	event.Timing.ReceiveHeadersEnd = milliseconds(received.Sub(start))
+	event.Response = NetworkResponse{
+		URL:         r.URL.String(),
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		MimeType:    mimeType(resp.Header.Get("Content-Type")),
+		ContentType: resp.Header.Get("Content-Type"),
+		Headers:     flattenHeaders(resp.Header),
+		Protocol:    strings.ToLower(resp.Proto),
+		Time:        received,
+	}
+
+	if setter, ok := r.Context().Value(eventKey{}).(func(*NetworkEvent)); ok {
+		setter(event)
+	}
+
+	return resp, nil
+}
+
+type eventKey struct{}
+type typeKey struct{}
+
+func typeFromContext(ctx context.Context) string {
+	typ, _ := ctx.Value(typeKey{}).(string)
+	return typ
+}
+
+// send runs the request and fills the body into the event of the final response
+func (c *HTTPContext) send(ctx context.Context, typ, method, target string, headers map[string]string, body string) (*NetworkEvent, error) {
+	var event *NetworkEvent
+	ctx = context.WithValue(ctx, typeKey{}, typ)
+	ctx = context.WithValue(ctx, eventKey{}, func(ev *NetworkEvent) { event = ev })
+
+	request := c.client.R().SetContext(ctx).SetHeaders(headers)
+	if body != "" {
+		request.SetBodyString(body)
+	}
+
+	start := time.Now()
+	resp, err := request.Send(method, target)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, errors.New("response was not captured")
+	}
+
+	event.Response.Body = resp.Bytes()
+	if resp.ContentLength >= 0 {
+		event.Response.EncodedDataLength = resp.ContentLength
+	}
+	event.Timing.LoadingFinished = milliseconds(time.Since(start))
+
+	return event, nil
+}
+
+func (c *HTTPContext) navigate(ctx context.Context, ins NavigateInstruction) error {
+	if ins.DoneCondition != nil {
+		c.logger.Debug("http", "message", "done condition is met by the response", "condition", fmt.Sprintf("%T", ins.DoneCondition))
+	}
+
+	c.setDocument(nil)
+
+	event, err := c.send(ctx, "Document", http.MethodGet, ins.URL, nil, "")
+	if err != nil {
+		return err
+	}
+
+	c.setDocument(event)
+	c.State.Source, err = event.Response.Text()
+	if err != nil {
+		return err
+	}
+
+	return c.detectBlock()
+}
+
+func (c *HTTPContext) request(ctx context.Context, ins RequestInstruction) (*RequestResponse, error) {
+	method := ins.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if err := ins.filter(ins.URL); err != nil {
+		return nil, err
+	}
+
+	event, err := c.send(ctx, "Fetch", method, ins.URL, ins.Headers, ins.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &RequestResponse{
+		URL:        event.Response.URL,
+		Status:     event.Response.Status,
+		StatusText: event.Response.StatusText,
+		Headers:    event.Response.Headers,
+		Body:       event.Response.Body,
+	}
+
+	return resp, ins.filter(resp.URL)
+}
+
+func (c *HTTPContext) detectBlock() error {
+	if c.blockDetector == nil {
+		return nil
+	}
+
+	c.documentMu.Lock()
+	page := BlockPage{HTML: c.State.Source}
+	if c.document != nil {
+		page.URL = c.document.Response.URL
+		page.Status = c.document.Response.Status
+		page.Headers = c.document.Response.Headers
+	}
+	c.documentMu.Unlock()
+
+	if blocked := c.blockDetector.Detect(page); blocked != nil {
+		c.logger.Info("http", "message", "block detected", "site", blocked.SiteId, "reason", blocked.Reason, "status", blocked.Status)
+		return *blocked
+	}
+
+	return nil
+}
+
+func (c *HTTPContext) setDocument(ev *NetworkEvent) {
+	c.documentMu.Lock()
+	defer c.documentMu.Unlock()
+
+	c.document = ev
+}
+
+func (c *HTTPContext) executor() executor {
+	return executor{
+		ctx:      c.ctx,
+		loader:   c,
+		registry: c.registry,
+		timeout:  c.timeout,
+		logger:   c.logger,
+	}
+}
+
+func (c *HTTPContext) Do(ins ...Instruction) ([]Result, error) {
+	doStart := time.Now()
+
+	result, err := c.executor().run(ins...)
+	if err != nil {
+		return result, err
+	}
+
+	result = append(result, Result{Type: "html", Value: c.State.Source, Duration: time.Since(doStart)})
+	return result, nil
+}
+
+func (c *HTTPContext) RegisterProxyAgent(a ProxyGetter) {
+	c.ProxyAgent = a
+}
+
+// SetBinPath does nothing, there is no browser
+func (c *HTTPContext) SetBinPath(path string) {}
+
+func (c *HTTPContext) ChangeProxy() error {
+	return c.ProxyAgent.SetProxy()
+}
+
+func (c *HTTPContext) GetState() *State {
+	return c.State
+}
+
+func (c *HTTPContext) ClearState() {
+	c.State = &State{}
+}
+
+// Reset drops the cookies and the state, the proxy set by ChangeProxy is already in use
+func (c *HTTPContext) Reset() {
+	c.Close()
+
+	c.State = &State{}
+	c.setDocument(nil)
+	if err := c.Initialize(); err != nil {
+		c.logger.Error("http", "message", "failed to reset", "error", err)
+	}
+}
+
+func (c *HTTPContext) Close() {
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	c.client.GetTransport().CloseIdleConnections()
+}
+
+func flattenHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func mimeType(contentType string) string {
+	mime, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(mime)
+}
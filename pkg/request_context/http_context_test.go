@@ -0,0 +1,185 @@
+package requestcontext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	forwardproxy "github.com/dovydasdo/psec/pkg/forward_proxy"
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+// endpointAgent points at a fixed proxy server
+type endpointAgent struct {
+	testProxyAgent
+	server string
+}
+
+func (a *endpointAgent) ProxyServer() string { return a.server }
+
+func newHTTPContext(t *testing.T) *HTTPContext {
+	t.Helper()
+
+	c := GetHTTPContext(NewHTTPOptions(WithHTTPRetries(2, time.Millisecond)))
+	if err := c.Initialize(); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+func TestHTTPNavigate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+				http.Error(w, "no cookie", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body><h1>Test</h1></body></html>")
+		}
+	}))
+	defer ts.Close()
+
+	c := newHTTPContext(t)
+
+	results, err := c.Do(NavigateInstruction{URL: ts.URL, DoneCondition: DoneResponseReceived(ts.URL)})
+	if err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	if last := results[len(results)-1]; last.Type != "html" || !strings.Contains(last.Value.(string), "<h1>Test</h1>") {
+		t.Errorf("unexpected html result: %+v", last)
+	}
+	if c.GetState().Source != "<html><body><h1>Test</h1></body></html>" {
+		t.Errorf("unexpected source: %v", c.GetState().Source)
+	}
+
+	events := make([]*NetworkEvent, 0)
+	c.GetState().NetworkEvents.Range(func(_, value interface{}) bool {
+		events = append(events, value.(*NetworkEvent))
+		return true
+	})
+
+	if len(events) != 2 {
+		t.Fatalf("expected the redirect and the page, got %v events", len(events))
+	}
+	for _, ev := range events {
+		if ev.Request.Type != "Document" || ev.Request.Headers["User-Agent"] == "" {
+			t.Errorf("unexpected request: %+v", ev.Request)
+		}
+		if ev.Response.Status == http.StatusOK && (ev.Response.MimeType != "text/html" || len(ev.Response.Body) == 0) {
+			t.Errorf("unexpected response: %+v", ev.Response)
+		}
+	}
+
+	// Reset drops the cookies
+	c.Reset()
+	results, err = c.Do(RequestInstruction{URL: ts.URL + "/page"})
+	if err != nil {
+		t.Fatalf("failed to request: %v", err)
+	}
+	if status := results[0].Value.(*RequestResponse).Status; status != http.StatusBadRequest {
+		t.Errorf("cookies were kept after reset, got %v", status)
+	}
+}
+
+func TestHTTPRequest(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"method":%q,"body":%q,"token":%q}`, r.Method, body, r.Header.Get("X-Token"))
+	}))
+	defer ts.Close()
+
+	c := newHTTPContext(t)
+
+	results, err := c.Do(RequestInstruction{
+		URL:     ts.URL,
+		Method:  http.MethodPost,
+		Headers: map[string]string{"X-Token": "secret"},
+		Body:    `{"q":1}`,
+	})
+	if err != nil {
+		t.Fatalf("failed to request: %v", err)
+	}
+
+	resp := results[0].Value.(*RequestResponse)
+	var data map[string]string
+	if err := resp.JSON(&data); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if data["method"] != "POST" || data["body"] != `{"q":1}` || data["token"] != "secret" {
+		t.Errorf("unexpected request on the server: %v", data)
+	}
+	if calls != 2 {
+		t.Errorf("expected a retry after 503, got %v calls", calls)
+	}
+
+	_, err = c.Do(RequestInstruction{URL: ts.URL, Filter: *regexp.MustCompile(`/api/`)})
+	if !errors.Is(err, ErrRequestFiltered) || calls != 2 {
+		t.Errorf("expected the request to be filtered before it is sent, got %v after %v calls", err, calls)
+	}
+
+	results, _ = c.Do(JSEvalInstruction{Script: "1"})
+	if !errors.Is(results[0].Error, ErrInstructionNotSupported) {
+		t.Errorf("expected js to be unsupported, got %v", results[0].Error)
+	}
+}
+
+func TestHTTPBlocked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>Just a moment...</title>")
+	}))
+	defer ts.Close()
+
+	c := newHTTPContext(t)
+
+	_, err := c.Do(NavigateInstruction{URL: ts.URL})
+
+	var blocked perrors.Blocked
+	if !errors.As(err, &blocked) || blocked.Action != perrors.BLOCKED_RETRY {
+		t.Errorf("expected a blocked error, got %v", err)
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	proxy := forwardproxy.New(forwardproxy.NewOptions())
+	if err := proxy.Start(); err != nil {
+		t.Fatalf("failed to start proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	c := newHTTPContext(t)
+	c.RegisterProxyAgent(&endpointAgent{server: proxy.URL()})
+
+	if _, err := c.Do(NavigateInstruction{URL: ts.URL}); err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+
+	if proxy.Traffic()["direct"].Received == 0 {
+		t.Errorf("request did not go through the proxy")
+	}
+}
@@ -0,0 +1,85 @@
+package requestcontext
+
+import (
+	"log/slog"
+	"time"
+)
+
+type HTTPOption func(opts *HTTPOptions)
+
+type HTTPOptions struct {
+	// Timeout is the default deadline of a single instruction, retries included
+	Timeout time.Duration
+	// Retries of a request that failed or got a 429 or 5xx response
+	Retries int
+	// RetryBackoff is the first wait between retries, it doubles up to ten times that
+	RetryBackoff time.Duration
+	// UserAgent replaces the one of the impersonated Chrome
+	UserAgent string
+	// Headers are sent with every request
+	Headers map[string]string
+	// Registry holds handlers for custom instructions, DefaultRegistry is used if nil
+	Registry *Registry
+	// BlockDetector runs after every navigation, nil disables detection
+	BlockDetector BlockDetector
+	Logger        *slog.Logger
+}
+
+func NewHTTPOptions(setters ...HTTPOption) *HTTPOptions {
+	opts := &HTTPOptions{
+		// Defaults
+		Timeout:       30 * time.Second,
+		Retries:       2,
+		RetryBackoff:  500 * time.Millisecond,
+		BlockDetector: NewBlockDetector(),
+	}
+
+	for _, setter := range setters {
+		setter(opts)
+	}
+
+	return opts
+}
+
+func WithHTTPTimeout(timeout time.Duration) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.Timeout = timeout
+	}
+}
+
+func WithHTTPRetries(retries int, backoff time.Duration) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.Retries = retries
+		opts.RetryBackoff = backoff
+	}
+}
+
+func WithHTTPUserAgent(userAgent string) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.UserAgent = userAgent
+	}
+}
+
+func WithHTTPHeaders(headers map[string]string) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.Headers = headers
+	}
+}
+
+func WithHTTPRegistry(registry *Registry) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.Registry = registry
+	}
+}
+
+func WithHTTPBlockDetector(detector BlockDetector) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.BlockDetector = detector
+	}
+}
+
+func WithHTTPLogger(logger *slog.Logger) HTTPOption {
+	return func(opts *HTTPOptions) {
+		opts.Logger = logger
+	}
+}
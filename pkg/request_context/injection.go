@@ -0,0 +1,131 @@
+package requestcontext
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/chromedp/cdproto/page"
+	util "github.com/dovydasdo/psec/util/injections"
+)
+
+// Script is injected into every document of its sites before the page scripts run. Source is a
+// text/template executed with the active FingerprintProfile, {{json .Platform}} renders a js literal.
+type Script struct {
+	Name   string
+	Source string
+	// Sites limits the script to documents with a matching url, empty means every site. The check runs
+	// in the page, so regexes have to be valid in js as well.
+	Sites []URLPattern
+}
+
+var scriptFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (s Script) render(profile *FingerprintProfile) (string, error) {
+	tmpl, err := template.New(s.Name).Funcs(scriptFuncs).Parse(s.Source)
+	if err != nil {
+		return "", err
+	}
+
+	var source strings.Builder
+	if err := tmpl.Execute(&source, profile); err != nil {
+		return "", err
+	}
+
+	if len(s.Sites) == 0 {
+		return source.String(), nil
+	}
+
+	sites := make([]string, 0, len(s.Sites))
+	for _, site := range s.Sites {
+		sites = append(sites, sitePattern(site))
+	}
+
+	data, err := json.Marshal(sites)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("if (%s.some((site) => new RegExp(site).test(location.href))) {\n%s\n}", data, source.String()), nil
+}
+
+// sitePattern is the regex of the pattern that the page can test its url with
+func sitePattern(p URLPattern) string {
+	switch {
+	case p.Exact != "":
+		exact := p.Exact
+		if u, err := url.Parse(exact); err == nil {
+			exact = normalizeURL(u)
+		}
+		return "^" + regexp.QuoteMeta(exact) + "/?$"
+	case p.Glob != "":
+		parts := strings.Split(p.Glob, "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		return "^" + strings.Join(parts, ".*") + "$"
+	case p.Regex != nil:
+		return p.Regex.String()
+	default:
+		return "$^"
+	}
+}
+
+// injections are the scripts added to every document: the file at InjectionPath if set, the stealth
+// bundle with the profile overrides, then the user scripts. The bundle is added even without stealth
+// modules, the overrides use its utils.
+func (c *CDPContext) injections() ([]*page.AddScriptToEvaluateOnNewDocumentParams, error) {
+	params := make([]*page.AddScriptToEvaluateOnNewDocumentParams, 0, len(c.scripts)+2)
+	add := func(source string) {
+		params = append(params, page.AddScriptToEvaluateOnNewDocument(source).WithRunImmediately(true))
+	}
+
+	modules := c.stealthModules
+	if c.injectionPath != "" {
+		injection, err := GetInjection(c.injectionPath)
+		if err != nil {
+			return nil, err
+		}
+		add(injection)
+		modules = nil
+	}
+
+	profile, err := c.profile.script()
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := util.StealthBundle(profile, modules...)
+	if err != nil {
+		return nil, err
+	}
+	add(bundle)
+
+	for _, script := range c.scripts {
+		source, err := script.render(c.profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render script %v: %w", script.Name, err)
+		}
+		add(source)
+	}
+
+	return params, nil
+}
+
+func GetInjection(path string) (string, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(file[:]), nil
+}
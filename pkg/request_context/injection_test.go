@@ -0,0 +1,86 @@
+package requestcontext
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestScriptRender(t *testing.T) {
+	profile := &FingerprintProfile{Platform: "Win32", WebGLVendor: `Google Inc. "NVIDIA"`}
+
+	script := Script{Name: "vendor", Source: `window.vendor = {{json .WebGLVendor}}; window.platform = '{{.Platform}}';`}
+	source, err := script.render(profile)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if source != `window.vendor = "Google Inc. \"NVIDIA\""; window.platform = 'Win32';` {
+		t.Errorf("unexpected source: %v", source)
+	}
+
+	script.Sites = []URLPattern{{Glob: "https://*.example.com/*"}}
+	source, err = script.render(profile)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if !strings.HasPrefix(source, "if (") || !strings.Contains(source, "location.href") {
+		t.Errorf("site check is missing: %v", source)
+	}
+
+	if _, err := (Script{Name: "broken", Source: "{{.Missing"}).render(profile); err == nil {
+		t.Errorf("expected an error for a broken template")
+	}
+}
+
+func TestSitePattern(t *testing.T) {
+	cases := []struct {
+		pattern URLPattern
+		url     string
+		match   bool
+	}{
+		{URLPattern{Exact: "https://Example.com/path/"}, "https://example.com/path", true},
+		{URLPattern{Exact: "https://example.com/path"}, "https://example.com/path/", true},
+		{URLPattern{Exact: "https://example.com/path"}, "https://example.com/path/more", false},
+		{URLPattern{Glob: "https://*.example.com/*"}, "https://www.example.com/a?b=c", true},
+		{URLPattern{Glob: "https://*.example.com/*"}, "https://example.org/", false},
+		{URLPattern{Regex: regexp.MustCompile(`^https://example\.com/items/\d+`)}, "https://example.com/items/12", true},
+		{URLPattern{}, "https://example.com/", false},
+	}
+
+	for _, c := range cases {
+		// The patterns run as js regexes, the syntax used here is the same in go
+		if got := regexp.MustCompile(sitePattern(c.pattern)).MatchString(c.url); got != c.match {
+			t.Errorf("%v matching %v = %v, want %v", c.pattern, c.url, got, c.match)
+		}
+	}
+}
+
+func TestStealthOptions(t *testing.T) {
+	options := NewCDPOptions(WithoutStealthModules("plugins", "permissions"))
+	if len(options.StealthModules) != 3 {
+		t.Errorf("expected 3 modules, got %v", options.StealthModules)
+	}
+
+	c := GetCDPContext(NewCDPOptions(WithStealthModules("nope")))
+	c.profile = &FingerprintProfile{}
+	if _, err := c.injections(); err == nil {
+		t.Errorf("expected an error for an unknown module")
+	}
+
+	c = GetCDPContext(NewCDPOptions(WithScripts(Script{Name: "a", Source: "1"}, Script{Name: "b", Source: "2"})))
+	c.profile = &FingerprintProfile{}
+	injections, err := c.injections()
+	if err != nil {
+		t.Fatalf("failed to prepare injections: %v", err)
+	}
+	// the stealth bundle with the profile overrides and the two scripts
+	if len(injections) != 3 {
+		t.Fatalf("expected 3 injections, got %v", len(injections))
+	}
+
+	// toString is patched once, the overrides use the helper of the bundle
+	bundle := injections[0].Source
+	if strings.Count(bundle, "Function.prototype.toString =") != 1 || !strings.Contains(bundle, "utils.makeNative(function getParameter") {
+		t.Errorf("profile overrides are not in the stealth bundle")
+	}
+}
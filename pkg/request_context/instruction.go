@@ -0,0 +1,161 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+var ErrInstructionNotSupported = errors.New("instruction is not supported by the loader")
+
+// Instruction is a single step performed by a Loader. Execute receives a ctx carrying the instruction
+// deadline, for the CDPContext it can be passed to chromedp.Run directly. Failures of the instruction
+// itself go into Result.Error, a returned error stops the remaining instructions.
+type Instruction interface {
+	Validate() error
+	Execute(ctx context.Context, l Loader) (Result, error)
+}
+
+// Timed is implemented by instructions that have their own deadline, zero means the loader default
+type Timed interface {
+	GetTimeout() time.Duration
+}
+
+// Named is implemented by instructions that carry a name for their result
+type Named interface {
+	GetName() string
+}
+
+// InstructionHandler executes an instruction in place of its Execute method
+type InstructionHandler func(ctx context.Context, l Loader, ins Instruction) (Result, error)
+
+// Registry maps instruction types to handlers, so site specific steps or loader specific
+// implementations can be plugged in without changing the instructions themselves.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[reflect.Type]InstructionHandler
+}
+
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[reflect.Type]InstructionHandler),
+	}
+}
+
+// Register sets the handler for the type of ins, the value itself is only used for its type
+func (r *Registry) Register(ins Instruction, handler InstructionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[reflect.TypeOf(ins)] = handler
+}
+
+func (r *Registry) Handler(ins Instruction) (InstructionHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	handler, ok := r.handlers[reflect.TypeOf(ins)]
+	return handler, ok
+}
+
+// RegisterInstruction sets the handler in the DefaultRegistry
+func RegisterInstruction(ins Instruction, handler InstructionHandler) {
+	DefaultRegistry.Register(ins, handler)
+}
+
+// executor runs instructions for a loader, it is shared by all of the loader implementations
+type executor struct {
+	ctx      context.Context
+	loader   Loader
+	registry *Registry
+	timeout  time.Duration
+	logger   *slog.Logger
+}
+
+func (e executor) run(ins ...Instruction) ([]Result, error) {
+	result := make([]Result, 0)
+
+	for _, instruction := range ins {
+		if instruction == nil {
+			return result, errors.New("nil instruction provided")
+		}
+
+		if err := instruction.Validate(); err != nil {
+			return result, fmt.Errorf("invalid %T instruction: %w", instruction, err)
+		}
+	}
+
+	for _, instruction := range ins {
+		var timeout time.Duration
+		if timed, ok := instruction.(Timed); ok {
+			timeout = timed.GetTimeout()
+		}
+
+		var res Result
+		err := e.execute(timeout, &res, func(ctx context.Context) error {
+			var err error
+			if handler, ok := e.registry.Handler(instruction); ok {
+				res, err = handler(ctx, e.loader, instruction)
+			} else {
+				res, err = instruction.Execute(ctx, e.loader)
+			}
+			return err
+		})
+
+		if named, ok := instruction.(Named); ok {
+			res.Name = named.GetName()
+		}
+
+		e.logger.Debug("loader.do", "result", res.Type, "name", res.Name, "duration", res.Duration)
+
+		result = append(result, res)
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// execute runs fn under its own deadline derived from the loader context, zero timeout means the loader
+// default. Hitting the deadline is reported as perrors.Timeout, both in res.Error and the returned error.
+func (e executor) execute(timeout time.Duration, res *Result, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		timeout = e.timeout
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(e.ctx, timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	res.Duration = time.Since(start)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.Error = asTimeout(res.Error, res.Type, res.Duration)
+		err = asTimeout(err, res.Type, res.Duration)
+	}
+
+	return err
+}
+
+func asTimeout(err error, typ string, after time.Duration) error {
+	var timeoutErr perrors.Timeout
+	if err == nil || errors.As(err, &timeoutErr) {
+		return err
+	}
+
+	return perrors.Timeout{
+		Reason: fmt.Sprintf("%v instruction did not complete in time", typ),
+		After:  after,
+	}
+}
@@ -0,0 +1,124 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
+
+type sleepInstruction struct {
+	*BaseInstruction
+	Sleep   time.Duration
+	Timeout time.Duration
+}
+
+func (ins sleepInstruction) Validate() error {
+	if ins.Sleep < 0 {
+		return errors.New("sleep can not be negative")
+	}
+	return nil
+}
+
+func (ins sleepInstruction) GetTimeout() time.Duration {
+	return ins.Timeout
+}
+
+func (ins sleepInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	select {
+	case <-time.After(ins.Sleep):
+		return Result{Type: "sleep", Value: true}, nil
+	case <-ctx.Done():
+		return Result{Type: "sleep", Error: ctx.Err()}, ctx.Err()
+	}
+}
+
+type markInstruction struct{}
+
+func (markInstruction) Validate() error {
+	return nil
+}
+
+func (markInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	return Result{Type: "mark", Value: "execute"}, nil
+}
+
+func testExecutor(registry *Registry) executor {
+	return executor{
+		ctx:      context.Background(),
+		registry: registry,
+		timeout:  time.Second,
+		logger:   slog.Default(),
+	}
+}
+
+func TestExecutorTimeout(t *testing.T) {
+	exec := testExecutor(NewRegistry())
+
+	result, err := exec.run(
+		sleepInstruction{BaseInstruction: &BaseInstruction{Name: "short"}, Sleep: 50 * time.Millisecond},
+		sleepInstruction{Sleep: time.Hour, Timeout: 10 * time.Millisecond},
+		sleepInstruction{},
+	)
+
+	if _, ok := err.(perrors.Timeout); !ok {
+		t.Fatalf("expected a timeout error, got: %v", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatalf("expected execution to stop after the timeout, got %v results", len(result))
+	}
+
+	if result[0].Name != "short" || result[0].Duration < 50*time.Millisecond {
+		t.Errorf("unexpected first result: %+v", result[0])
+	}
+
+	if _, ok := result[1].Error.(perrors.Timeout); !ok {
+		t.Errorf("expected a timeout error in the result, got: %v", result[1].Error)
+	}
+}
+
+func TestExecutorValidation(t *testing.T) {
+	exec := testExecutor(NewRegistry())
+
+	result, err := exec.run(markInstruction{}, sleepInstruction{Sleep: -1})
+	if err == nil {
+		t.Errorf("expected a validation error")
+	}
+
+	if len(result) != 0 {
+		t.Errorf("no instruction should run if any of them is invalid")
+	}
+
+	_, err = exec.run(NavigateInstruction{})
+	if err == nil {
+		t.Errorf("expected navigation without an url to be invalid")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	exec := testExecutor(registry)
+
+	result, err := exec.run(markInstruction{})
+	if err != nil || result[0].Value != "execute" {
+		t.Fatalf("unexpected result without a handler: %+v, err: %v", result, err)
+	}
+
+	registry.Register(markInstruction{}, func(ctx context.Context, l Loader, ins Instruction) (Result, error) {
+		return Result{Type: "mark", Value: "handler"}, nil
+	})
+
+	result, err = exec.run(markInstruction{})
+	if err != nil || result[0].Value != "handler" {
+		t.Errorf("registered handler was not used: %+v, err: %v", result, err)
+	}
+
+	_, err = exec.run(NavigateInstruction{URL: "http://localhost"})
+	if !errors.Is(err, ErrInstructionNotSupported) {
+		t.Errorf("expected unsupported instruction error, got: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package requestcontext
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+)
+
+type InterceptAction int
+
+const (
+	// INTERCEPT_CONTINUE lets the request through, with Headers and PostData applied if set
+	INTERCEPT_CONTINUE InterceptAction = iota
+	INTERCEPT_BLOCK
+	// INTERCEPT_FULFILL answers the request with Response without it reaching the network
+	INTERCEPT_FULFILL
+	// INTERCEPT_REWRITE sends the request to RewriteURL, the page still sees the original url
+	INTERCEPT_REWRITE
+)
+
+// InterceptRule matches requests by url, resource type and method, empty fields match everything
+type InterceptRule struct {
+	URL          URLPattern
+	ResourceType string
+	Method       string
+
+	Action InterceptAction
+	// Headers are merged into the request headers, an empty value removes the header
+	Headers  map[string]string
+	PostData string
+	Response *InterceptResponse
+	// RewriteURL has to keep the scheme of the original url
+	RewriteURL string
+}
+
+type InterceptResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+func (r InterceptRule) Match(url, resourceType, method string) bool {
+	if r.URL.String() != "" && !r.URL.Match(url) {
+		return false
+	}
+
+	if r.ResourceType != "" && !strings.EqualFold(r.ResourceType, resourceType) {
+		return false
+	}
+
+	if r.Method != "" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+
+	return true
+}
+
+// AddInterceptRules adds rules applied to every request, rules of the running instruction take precedence
+func (c *CDPContext) AddInterceptRules(rules ...InterceptRule) {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	c.rules = append(c.rules, rules...)
+}
+
+func (c *CDPContext) ClearInterceptRules() {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	c.rules = nil
+}
+
+// withInstructionRules activates rules until the returned func is called
+func (c *CDPContext) withInstructionRules(rules []InterceptRule) func() {
+	if len(rules) == 0 {
+		return func() {}
+	}
+
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	c.instructionRules = rules
+
+	return func() {
+		c.rulesMu.Lock()
+		defer c.rulesMu.Unlock()
+
+		c.instructionRules = nil
+	}
+}
+
+func (c *CDPContext) matchInterceptRule(ev *fetch.EventRequestPaused) (InterceptRule, bool) {
+	c.rulesMu.RLock()
+	defer c.rulesMu.RUnlock()
+
+	for _, rules := range [][]InterceptRule{c.instructionRules, c.rules} {
+		for _, rule := range rules {
+			if rule.Match(ev.Request.URL, string(ev.ResourceType), ev.Request.Method) {
+				return rule, true
+			}
+		}
+	}
+
+	return InterceptRule{}, false
+}
+
+// applyInterceptRule resolves a request paused at the request stage according to the rule
+func applyInterceptRule(ctx context.Context, ev *fetch.EventRequestPaused, rule InterceptRule) error {
+	switch rule.Action {
+	case INTERCEPT_BLOCK:
+		return fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+	case INTERCEPT_FULFILL:
+		resp := rule.Response
+		if resp == nil {
+			resp = &InterceptResponse{}
+		}
+
+		status := resp.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		params := fetch.FulfillRequest(ev.RequestID, int64(status)).
+			WithResponseHeaders(headerEntries(resp.Headers)).
+			WithBody(base64.StdEncoding.EncodeToString(resp.Body))
+		return params.Do(ctx)
+	case INTERCEPT_REWRITE:
+		params := fetch.ContinueRequest(ev.RequestID)
+		params.URL = rule.RewriteURL
+		params.InterceptResponse = true
+		return params.Do(ctx)
+	default:
+		params := fetch.ContinueRequest(ev.RequestID)
+		params.InterceptResponse = true
+
+		if len(rule.Headers) > 0 {
+			headers := GetHeaders(ev.Request.Headers)
+			for name, value := range rule.Headers {
+				for existing := range headers {
+					if strings.EqualFold(existing, name) {
+						delete(headers, existing)
+					}
+				}
+
+				if value != "" {
+					headers[name] = value
+				}
+			}
+			params.Headers = headerEntries(headers)
+		}
+
+		if rule.PostData != "" {
+			params.PostData = base64.StdEncoding.EncodeToString([]byte(rule.PostData))
+		}
+
+		return params.Do(ctx)
+	}
+}
+
+func headerEntries(headers map[string]string) []*fetch.HeaderEntry {
+	entries := make([]*fetch.HeaderEntry, 0, len(headers))
+	for name, value := range headers {
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
@@ -0,0 +1,71 @@
+package requestcontext
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestInterceptRuleMatch(t *testing.T) {
+	cases := []struct {
+		rule         InterceptRule
+		url          string
+		resourceType string
+		method       string
+		want         bool
+	}{
+		{InterceptRule{}, "https://example.com/", "Document", "GET", true},
+		{InterceptRule{URL: URLPattern{Glob: "*google-analytics.com*"}}, "https://www.google-analytics.com/collect", "XHR", "POST", true},
+		{InterceptRule{URL: URLPattern{Glob: "*google-analytics.com*"}}, "https://example.com/", "Document", "GET", false},
+		{InterceptRule{ResourceType: "image"}, "https://example.com/logo.png", "Image", "GET", true},
+		{InterceptRule{ResourceType: "Image"}, "https://example.com/app.js", "Script", "GET", false},
+		{InterceptRule{Method: "post", URL: URLPattern{Regex: regexp.MustCompile(`/api/`)}}, "https://example.com/api/items", "Fetch", "POST", true},
+		{InterceptRule{Method: "POST", URL: URLPattern{Regex: regexp.MustCompile(`/api/`)}}, "https://example.com/api/items", "Fetch", "GET", false},
+	}
+
+	for i, tc := range cases {
+		if got := tc.rule.Match(tc.url, tc.resourceType, tc.method); got != tc.want {
+			t.Errorf("case %v: wanted %v, got %v", i, tc.want, got)
+		}
+	}
+}
+
+func TestInterceptRulePrecedence(t *testing.T) {
+	ctx := &CDPContext{}
+	ctx.AddInterceptRules(
+		InterceptRule{ResourceType: "Image", Action: INTERCEPT_BLOCK},
+		InterceptRule{Action: INTERCEPT_CONTINUE, Headers: map[string]string{"Authorization": "token"}},
+	)
+
+	ev := &fetch.EventRequestPaused{
+		Request:      &network.Request{URL: "https://example.com/logo.png", Method: "GET"},
+		ResourceType: network.ResourceTypeImage,
+	}
+
+	rule, ok := ctx.matchInterceptRule(ev)
+	if !ok || rule.Action != INTERCEPT_BLOCK {
+		t.Errorf("expected the global block rule to match")
+	}
+
+	done := ctx.withInstructionRules([]InterceptRule{{URL: URLPattern{Glob: "*.png"}, Action: INTERCEPT_FULFILL}})
+
+	rule, ok = ctx.matchInterceptRule(ev)
+	if !ok || rule.Action != INTERCEPT_FULFILL {
+		t.Errorf("expected the instruction rule to take precedence")
+	}
+
+	done()
+
+	rule, ok = ctx.matchInterceptRule(ev)
+	if !ok || rule.Action != INTERCEPT_BLOCK {
+		t.Errorf("instruction rules were not removed")
+	}
+
+	ctx.ClearInterceptRules()
+
+	if _, ok := ctx.matchInterceptRule(ev); ok {
+		t.Errorf("expected no rules after clearing")
+	}
+}
@@ -17,6 +17,18 @@ type ProxyGetter interface {
 	GetAuth() (*ProxyAuth, error)
 }
 
+// ProxyEndpoint is implemented by proxy agents that know the server the browser should connect to, like
+// http://host:port or socks5://host:port. Every session is started with the server reported at the time.
+type ProxyEndpoint interface {
+	ProxyServer() string
+}
+
+// ProxyLocator is implemented by proxy agents that know the country of their exit as an ISO 3166 code,
+// generated profiles get a timezone of that country
+type ProxyLocator interface {
+	ProxyCountry() string
+}
+
 type ProxyAuth struct {
 	Server   string
 	Username string
@@ -76,3 +88,7 @@ func (a *PSECProxyAgent) SetProxy() error {
 	}
 	return errors.New("no proxies")
 }
+
+func (a *PSECProxyAgent) ProxyID() string {
+	return a.CurrentProxy.Ip
+}
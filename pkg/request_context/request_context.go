@@ -7,6 +7,6 @@ type Loader interface {
 	ChangeProxy() error
 	GetState() *State
 	ClearState()
-	Do(ins ...interface{}) ([]Result, error)
+	Do(ins ...Instruction) ([]Result, error)
 	Reset()
 }
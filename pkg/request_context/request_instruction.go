@@ -1,12 +1,17 @@
 package requestcontext
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"regexp"
 	"time"
 
 	"github.com/go-rod/rod/lib/proto"
 )
 
+var ErrRequestFiltered = errors.New("url does not match the request filter")
+
 const (
 	SUCCESS = iota
 	TIMEOUT
@@ -21,9 +26,32 @@ type BaseInstruction struct {
 
 type RequestInstruction struct {
 	*BaseInstruction
-	URL    string
-	Method string
-	Filter regexp.Regexp
+	URL     string
+	Method  string
+	Headers map[string]string
+	Body    string
+	// Filter lets only matching urls through, the url the response came from after redirects as well.
+	// The zero value lets everything through.
+	Filter  regexp.Regexp
+	Timeout time.Duration
+	// Rules intercept requests while the instruction runs
+	Rules []InterceptRule
+}
+
+type RequestResponse struct {
+	URL        string            `json:"url"`
+	Status     int               `json:"status"`
+	StatusText string            `json:"statusText"`
+	Headers    map[string]string `json:"headers"`
+	Body       []byte            `json:"body"`
+}
+
+func (r RequestResponse) Text() (string, error) {
+	return decodeText(r.Body, headerValue(r.Headers, "Content-Type"))
+}
+
+func (r RequestResponse) JSON(v interface{}) error {
+	return decodeJSON(r.Body, headerValue(r.Headers, "Content-Type"), v)
 }
 
 type NavigateInstruction struct {
@@ -31,6 +59,9 @@ type NavigateInstruction struct {
 	URL           string
 	DoneCondition interface{}
 	Filters       []string
+	Timeout       time.Duration
+	// Rules intercept requests while the instruction runs
+	Rules []InterceptRule
 }
 
 type JSEvalInstruction struct {
@@ -40,10 +71,225 @@ type JSEvalInstruction struct {
 	Result  interface{}
 }
 
+type PaginateInstruction struct {
+	*BaseInstruction
+	// Action is one of PaginateClickNext, PaginateFollowLink or PaginateScroll
+	Action interface{}
+	// Stop holds StopNoNewItems, StopMaxPages or StopJSPredicate, pagination ends when any of them holds
+	Stop []interface{}
+	// Extract is evaluated on every page and its result is collected
+	Extract string
+	// DoneCondition is awaited after each action, if nil Delay is waited instead
+	DoneCondition interface{}
+	Delay         time.Duration
+	// Timeout covers all of the pages
+	Timeout time.Duration
+	// Rules intercept requests while the instruction runs
+	Rules []InterceptRule
+}
+
+type PaginateClickNext string
+
+type PaginateFollowLink string
+
+type PaginateScroll struct{}
+
+// StopNoNewItems holds a selector of the paginated items
+type StopNoNewItems string
+
+type StopMaxPages int
+
+type StopJSPredicate string
+
+type PageResult struct {
+	Page     int
+	URL      string
+	NewItems int
+	Value    interface{}
+}
+
+// Capabilities a loader has to provide to run the built in instructions
+
+type navigator interface {
+	navigate(ctx context.Context, ins NavigateInstruction) error
+}
+
+type evaluator interface {
+	evaluate(ctx context.Context, ins JSEvalInstruction) error
+}
+
+type requester interface {
+	request(ctx context.Context, ins RequestInstruction) (*RequestResponse, error)
+}
+
+type paginator interface {
+	paginate(ctx context.Context, ins PaginateInstruction) ([]PageResult, error)
+}
+
+func (b *BaseInstruction) GetName() string {
+	if b == nil {
+		return ""
+	}
+	return b.Name
+}
+
+func (ins NavigateInstruction) Validate() error {
+	if ins.URL == "" {
+		return errors.New("url is required")
+	}
+	return nil
+}
+
+func (ins NavigateInstruction) GetTimeout() time.Duration {
+	return ins.Timeout
+}
+
+func (ins NavigateInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	n, ok := l.(navigator)
+	if !ok {
+		return Result{Type: "navigate", Error: ErrInstructionNotSupported}, ErrInstructionNotSupported
+	}
+
+	err := n.navigate(ctx, ins)
+	return Result{Type: "navigate", Error: err}, err
+}
+
+func (ins JSEvalInstruction) Validate() error {
+	if ins.Script == "" {
+		return errors.New("script is required")
+	}
+	return nil
+}
+
+func (ins JSEvalInstruction) GetTimeout() time.Duration {
+	return ins.Timeout
+}
+
+// Execute of a script does not stop the remaining instructions on failure
+func (ins JSEvalInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	e, ok := l.(evaluator)
+	if !ok {
+		return Result{Type: "js_eval", Error: ErrInstructionNotSupported}, nil
+	}
+
+	err := e.evaluate(ctx, ins)
+
+	// this is stupid
+	return Result{Type: "js_eval", Value: ins.Result, Error: err}, nil
+}
+
+func (ins RequestInstruction) Validate() error {
+	if ins.URL == "" {
+		return errors.New("url is required")
+	}
+	return nil
+}
+
+func (ins RequestInstruction) GetTimeout() time.Duration {
+	return ins.Timeout
+}
+
+// filter fails with ErrRequestFiltered if Filter is set and does not match the url
+func (ins RequestInstruction) filter(url string) error {
+	if ins.Filter.String() == "" || ins.Filter.MatchString(url) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", ErrRequestFiltered, url)
+}
+
+func (ins RequestInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	r, ok := l.(requester)
+	if !ok {
+		return Result{Type: "request", Error: ErrInstructionNotSupported}, ErrInstructionNotSupported
+	}
+
+	resp, err := r.request(ctx, ins)
+	return Result{Type: "request", Value: resp, Error: err}, err
+}
+
+func (ins PaginateInstruction) Validate() error {
+	if ins.Action == nil {
+		return errors.New("pagination action is required")
+	}
+
+	if len(ins.Stop) == 0 {
+		return errors.New("pagination requires at least one stop condition")
+	}
+	return nil
+}
+
+func (ins PaginateInstruction) GetTimeout() time.Duration {
+	return ins.Timeout
+}
+
+func (ins PaginateInstruction) Execute(ctx context.Context, l Loader) (Result, error) {
+	p, ok := l.(paginator)
+	if !ok {
+		return Result{Type: "paginate", Error: ErrInstructionNotSupported}, ErrInstructionNotSupported
+	}
+
+	pages, err := p.paginate(ctx, ins)
+	return Result{Type: "paginate", Value: pages, Error: err}, err
+}
+
 type DoneElVisible string
 
+// DoneResponseReceived completes once the body of the response for the url is available
 type DoneResponseReceived string
 
+// Every condition below has its own timeout, zero means it is only bound by the caller
+
+type DoneNetworkIdle struct {
+	// Idle is how long there should be no requests in flight
+	Idle    time.Duration
+	Timeout time.Duration
+}
+
+type DoneElCount struct {
+	Selector string
+	Count    int
+	Timeout  time.Duration
+}
+
+type DoneElTextMatches struct {
+	Selector string
+	Pattern  *regexp.Regexp
+	Timeout  time.Duration
+}
+
+type DoneJSPredicate struct {
+	Script  string
+	Timeout time.Duration
+}
+
+// DoneResponseMatches completes once the body of a matching response is available, either Glob or URL has to be set
+type DoneResponseMatches struct {
+	Glob string
+	URL  *regexp.Regexp
+	// Status is ignored when zero
+	Status  int
+	Timeout time.Duration
+}
+
+type DoneLoad struct {
+	Timeout time.Duration
+}
+
+type DoneDOMContentLoaded struct {
+	Timeout time.Duration
+}
+
+type DoneAll struct {
+	Conditions []interface{}
+	Timeout    time.Duration
+}
+
+type DoneAny struct {
+	Conditions []interface{}
+	Timeout    time.Duration
+}
+
 type ReqCtxKey struct {
 	Id string
 }
@@ -0,0 +1,313 @@
+package requestcontext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+	savecontext "github.com/dovydasdo/psec/pkg/save_context"
+	"github.com/jackc/pgx/v5"
+)
+
+// Session is the browser state worth keeping between runs, storage is keyed by origin
+type Session struct {
+	Cookies        []*network.Cookie            `json:"cookies"`
+	LocalStorage   map[string]map[string]string `json:"localStorage"`
+	SessionStorage map[string]map[string]string `json:"sessionStorage"`
+	SavedAt        time.Time                    `json:"savedAt"`
+}
+
+// SessionStore keeps sessions by key, Load returns nil without an error if nothing was saved yet
+type SessionStore interface {
+	Load(key string) (*Session, error)
+	Save(key string, session *Session) error
+}
+
+// ProxyIdentifier is implemented by proxy agents that can tell which exit they currently use,
+// sessions are only reused through the same proxy identity
+type ProxyIdentifier interface {
+	ProxyID() string
+}
+
+func SessionKey(site, proxy string) string {
+	if proxy == "" {
+		return site
+	}
+	return fmt.Sprintf("%v@%v", site, proxy)
+}
+
+// FileSessionStore keeps every session as a json file in Dir
+type FileSessionStore struct {
+	Dir string
+}
+
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{Dir: dir}
+}
+
+func (s *FileSessionStore) Load(key string) (*Session, error) {
+	session := &Session{}
+	found, err := readJSONFile(s.Dir, key, session)
+	if !found || err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *FileSessionStore) Save(key string, session *Session) error {
+	return writeJSONFile(s.Dir, key, session)
+}
+
+// PSQLSessionStore keeps sessions in a postgres table with a text key and a json data column:
+//
+//	CREATE TABLE sessions (key TEXT PRIMARY KEY, data JSONB NOT NULL);
+//
+// The queries use postgres placeholders and upserts, the saver has to be backed by postgres (savecontext.PSQLSaver)
+type PSQLSessionStore struct {
+	Saver savecontext.Saver
+	Table string
+}
+
+func NewPSQLSessionStore(saver savecontext.Saver, table string) *PSQLSessionStore {
+	return &PSQLSessionStore{Saver: saver, Table: table}
+}
+
+func (s *PSQLSessionStore) Load(key string) (*Session, error) {
+	var data string
+	query := fmt.Sprintf("SELECT data::text FROM %v WHERE key = $1", s.Table)
+	_, err := s.Saver.QueryExists(query, &data, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	return session, json.Unmarshal([]byte(data), session)
+}
+
+func (s *PSQLSessionStore) Save(key string, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %v (key, data) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data", s.Table)
+	_, err = s.Saver.Exec(query, key, string(data))
+	return err
+}
+
+const storageExportScript = `(() => {
+	const dump = (s) => {
+		const items = {};
+		for (let i = 0; i < s.length; i++) {
+			const key = s.key(i);
+			items[key] = s.getItem(key);
+		}
+		return items;
+	};
+	try {
+		return {origin: location.origin, local: dump(localStorage), session: dump(sessionStorage)};
+	} catch (e) {
+		return {origin: location.origin, local: {}, session: {}};
+	}
+})()`
+
+// ExportSession reads all of the browser cookies and the storage of the current page origin
+func (c *CDPContext) ExportSession() (*Session, error) {
+	session := &Session{
+		LocalStorage:   make(map[string]map[string]string),
+		SessionStorage: make(map[string]map[string]string),
+		SavedAt:        time.Now(),
+	}
+
+	var items struct {
+		Origin  string            `json:"origin"`
+		Local   map[string]string `json:"local"`
+		Session map[string]string `json:"session"`
+	}
+
+	err := chromedp.Run(c.ctx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// Without the id storage reads the default browser context, not the one of the session
+			cookies, err := storage.GetCookies().WithBrowserContextID(chromedp.FromContext(ctx).BrowserContextID).Do(ctx)
+			session.Cookies = cookies
+			return err
+		}),
+		chromedp.Evaluate(storageExportScript, &items),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opaque origins like about:blank have no storage worth keeping
+	if items.Origin != "" && items.Origin != "null" {
+		if len(items.Local) > 0 {
+			session.LocalStorage[items.Origin] = items.Local
+		}
+		if len(items.Session) > 0 {
+			session.SessionStorage[items.Origin] = items.Session
+		}
+	}
+
+	return session, nil
+}
+
+// ImportSession sets the cookies right away, storage is filled in when a page of its origin loads
+func (c *CDPContext) ImportSession(session *Session) error {
+	if session == nil {
+		return nil
+	}
+
+	storageJSON, err := json.Marshal(map[string]interface{}{
+		"local":   session.LocalStorage,
+		"session": session.SessionStorage,
+	})
+	if err != nil {
+		return err
+	}
+
+	return chromedp.Run(c.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		if cookies := cookieParams(session.Cookies); len(cookies) > 0 {
+			if err := storage.SetCookies(cookies).WithBrowserContextID(chromedp.FromContext(ctx).BrowserContextID).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(session.LocalStorage) == 0 && len(session.SessionStorage) == 0 {
+			return nil
+		}
+
+		_, err := page.AddScriptToEvaluateOnNewDocument(storageImportScript(string(storageJSON))).Do(ctx)
+		return err
+	}))
+}
+
+// storageImportScript only sets missing items, values written by the page itself are left alone
+func storageImportScript(data string) string {
+	return fmt.Sprintf(`(() => {
+	const data = %v;
+	const fill = (s, items) => {
+		if (!items) return;
+		for (const [key, value] of Object.entries(items)) {
+			if (s.getItem(key) === null) s.setItem(key, value);
+		}
+	};
+	try {
+		fill(localStorage, (data.local || {})[location.origin]);
+		fill(sessionStorage, (data.session || {})[location.origin]);
+	} catch (e) {}
+})()`, data)
+}
+
+func cookieParams(cookies []*network.Cookie) []*network.CookieParam {
+	params := make([]*network.CookieParam, 0, len(cookies))
+	now := float64(time.Now().Unix())
+
+	for _, cookie := range cookies {
+		if !cookie.Session && cookie.Expires > 0 && cookie.Expires < now {
+			continue
+		}
+
+		param := &network.CookieParam{
+			Name:         cookie.Name,
+			Value:        cookie.Value,
+			Domain:       cookie.Domain,
+			Path:         cookie.Path,
+			Secure:       cookie.Secure,
+			HTTPOnly:     cookie.HTTPOnly,
+			SameSite:     cookie.SameSite,
+			Priority:     cookie.Priority,
+			SameParty:    cookie.SameParty,
+			SourceScheme: cookie.SourceScheme,
+			SourcePort:   cookie.SourcePort,
+			PartitionKey: cookie.PartitionKey,
+		}
+
+		if !cookie.Session && cookie.Expires > 0 {
+			expires := cdp.TimeSinceEpoch(time.Unix(0, int64(cookie.Expires*float64(time.Second))))
+			param.Expires = &expires
+		}
+
+		params = append(params, param)
+	}
+
+	return params
+}
+
+// mergeSessions keeps the storage of origins that are not in the newer session, cookies are always
+// taken from the newer one as the browser already had the old ones imported
+func mergeSessions(old, new *Session) *Session {
+	if old == nil {
+		return new
+	}
+
+	for origin, items := range old.LocalStorage {
+		if _, ok := new.LocalStorage[origin]; !ok {
+			new.LocalStorage[origin] = items
+		}
+	}
+
+	for origin, items := range old.SessionStorage {
+		if _, ok := new.SessionStorage[origin]; !ok {
+			new.SessionStorage[origin] = items
+		}
+	}
+
+	return new
+}
+
+// currentSessionKey is the key of the site with the identity of the current proxy
+func (c *CDPContext) currentSessionKey() string {
+	proxy := ""
+	if identifier, ok := c.ProxyAgent.(ProxyIdentifier); ok {
+		proxy = identifier.ProxyID()
+	}
+
+	return SessionKey(c.sessionSite, proxy)
+}
+
+// SaveSession exports the session into the configured store under the key it was restored with
+func (c *CDPContext) SaveSession() error {
+	if c.sessionStore == nil {
+		return errors.New("no session store configured")
+	}
+
+	session, err := c.ExportSession()
+	if err != nil {
+		return err
+	}
+
+	old, err := c.sessionStore.Load(c.sessionKey)
+	if err != nil {
+		c.logger.Warn("cdp", "message", "failed to load previous session, overwriting", "key", c.sessionKey, "error", err)
+	}
+
+	return c.sessionStore.Save(c.sessionKey, mergeSessions(old, session))
+}
+
+// RestoreSession imports the session saved for the site and the current proxy identity
+func (c *CDPContext) RestoreSession() error {
+	if c.sessionStore == nil {
+		return errors.New("no session store configured")
+	}
+
+	c.sessionKey = c.currentSessionKey()
+
+	session, err := c.sessionStore.Load(c.sessionKey)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Debug("cdp", "message", "restoring session", "key", c.sessionKey, "found", session != nil)
+
+	return c.ImportSession(session)
+}
@@ -0,0 +1,89 @@
+package requestcontext
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	store := NewFileSessionStore(t.TempDir())
+	key := SessionKey("example.com", "10.0.0.1:8080")
+
+	session, err := store.Load(key)
+	if err != nil || session != nil {
+		t.Fatalf("expected no session, got %v %v", session, err)
+	}
+
+	saved := &Session{
+		Cookies:        []*network.Cookie{{Name: "sid", Value: "abc", Domain: ".example.com", Path: "/", Session: true, Priority: network.CookiePriorityMedium, SourceScheme: network.CookieSourceSchemeSecure}},
+		LocalStorage:   map[string]map[string]string{"https://example.com": {"consent": "yes"}},
+		SessionStorage: map[string]map[string]string{},
+	}
+
+	if err := store.Save(key, saved); err != nil {
+		t.Fatalf("failed to save session: %v", err)
+	}
+
+	session, err = store.Load(key)
+	if err != nil {
+		t.Fatalf("failed to load session: %v", err)
+	}
+
+	if len(session.Cookies) != 1 || session.Cookies[0].Value != "abc" {
+		t.Errorf("cookies were not restored: %+v", session.Cookies)
+	}
+
+	if session.LocalStorage["https://example.com"]["consent"] != "yes" {
+		t.Errorf("local storage was not restored: %+v", session.LocalStorage)
+	}
+
+	other, _ := store.Load(SessionKey("example.com", "10.0.0.2:8080"))
+	if other != nil {
+		t.Errorf("session leaked to another proxy identity")
+	}
+}
+
+func TestCookieParams(t *testing.T) {
+	now := float64(time.Now().Unix())
+	cookies := []*network.Cookie{
+		{Name: "session", Value: "1", Session: true, Expires: -1},
+		{Name: "valid", Value: "2", Expires: now + 3600},
+		{Name: "expired", Value: "3", Expires: now - 3600},
+	}
+
+	params := cookieParams(cookies)
+	if len(params) != 2 {
+		t.Fatalf("expected 2 cookies, got %v", len(params))
+	}
+
+	if params[0].Expires != nil {
+		t.Errorf("session cookie should not have an expiry")
+	}
+
+	if params[1].Expires == nil || params[1].Expires.Time().Unix() != int64(now+3600) {
+		t.Errorf("expiry was not kept: %v", params[1].Expires)
+	}
+}
+
+func TestMergeSessions(t *testing.T) {
+	old := &Session{
+		LocalStorage:   map[string]map[string]string{"https://a.com": {"k": "old"}, "https://b.com": {"k": "b"}},
+		SessionStorage: map[string]map[string]string{"https://b.com": {"s": "b"}},
+	}
+	current := &Session{
+		LocalStorage:   map[string]map[string]string{"https://a.com": {"k": "new"}},
+		SessionStorage: map[string]map[string]string{},
+	}
+
+	merged := mergeSessions(old, current)
+
+	if merged.LocalStorage["https://a.com"]["k"] != "new" {
+		t.Errorf("newer storage was overwritten")
+	}
+
+	if merged.LocalStorage["https://b.com"]["k"] != "b" || merged.SessionStorage["https://b.com"]["s"] != "b" {
+		t.Errorf("storage of other origins was lost: %+v", merged)
+	}
+}
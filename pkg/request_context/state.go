@@ -1,6 +1,14 @@
 package requestcontext
 
-import "sync"
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
 
 type State struct {
 	NetworkEvents sync.Map
@@ -10,17 +18,90 @@ type State struct {
 type NetworkEvent struct {
 	Request  NetworkRequest
 	Response NetworkResponse
-	// TODO: timings and stuff maybe
+	Timing   NetworkTiming
+}
+
+// NetworkTiming is the resource timing reported by the browser. RequestTime is a baseline in seconds,
+// the rest are milliseconds relative to it, -1 marks a phase that did not happen.
+type NetworkTiming struct {
+	RequestTime         float64
+	ProxyStart          float64
+	ProxyEnd            float64
+	DNSStart            float64
+	DNSEnd              float64
+	ConnectStart        float64
+	ConnectEnd          float64
+	SSLStart            float64
+	SSLEnd              float64
+	WorkerStart         float64
+	WorkerReady         float64
+	SendStart           float64
+	SendEnd             float64
+	PushStart           float64
+	PushEnd             float64
+	ReceiveHeadersStart float64
+	ReceiveHeadersEnd   float64
+	// LoadingFinished is when the whole body has been received
+	LoadingFinished float64
 }
 
 type NetworkRequest struct {
 	URL     string
+	Method  string
 	Body    string
 	Headers map[string]string
+	// Type is the resource type, e.g. Document, XHR or Image
+	Type string
+	// Time is when the request was sent
+	Time time.Time
 }
 
 type NetworkResponse struct {
-	URL     string
-	Body    string
-	Headers map[string]string
+	URL        string
+	Status     int
+	StatusText string
+	MimeType   string
+	// Body holds the decoded bytes as they were received, use Text or JSON to read it
+	Body []byte
+	// ContentType is the Content-Type header of the response, it decides the charset in Text
+	ContentType string
+	// Base64Encoded is set when the browser handed the body over base64 encoded, which it does for binary content
+	Base64Encoded bool
+	Headers       map[string]string
+	RemoteIP      string
+	RemotePort    int
+	Protocol      string
+	FromCache     bool
+	// EncodedDataLength is the number of bytes received over the network
+	EncodedDataLength int64
+	// Time is when the response headers were received
+	Time time.Time
+}
+
+// Text decodes the body to UTF-8 using the charset from the content type, or sniffed from the body if there is none
+func (r NetworkResponse) Text() (string, error) {
+	return decodeText(r.Body, r.ContentType)
+}
+
+func (r NetworkResponse) JSON(v interface{}) error {
+	return decodeJSON(r.Body, r.ContentType, v)
+}
+
+func decodeText(body []byte, contentType string) (string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := io.ReadAll(reader)
+	return string(text), err
+}
+
+func decodeJSON(body []byte, contentType string, v interface{}) error {
+	text, err := decodeText(body, contentType)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(text), v)
 }
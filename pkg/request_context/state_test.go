@@ -0,0 +1,46 @@
+package requestcontext
+
+import "testing"
+
+func TestResponseText(t *testing.T) {
+	resp := NetworkResponse{
+		Body:        []byte("Vilni\xf8"),
+		ContentType: "text/html; charset=windows-1257",
+	}
+
+	text, err := resp.Text()
+	if err != nil {
+		t.Fatalf("failed to decode text: %v", err)
+	}
+
+	if text != "Vilnių" {
+		t.Errorf("charset was not applied, got: %v", text)
+	}
+
+	resp = NetworkResponse{
+		Body:        []byte(`{"items":[1,2,3]}`),
+		ContentType: "application/json",
+	}
+
+	data := struct {
+		Items []int `json:"items"`
+	}{}
+
+	if err := resp.JSON(&data); err != nil {
+		t.Fatalf("failed to decode json: %v", err)
+	}
+
+	if len(data.Items) != 3 {
+		t.Errorf("unexpected json result: %+v", data)
+	}
+
+	fetched := RequestResponse{
+		Headers: map[string]string{"content-type": "text/plain; charset=iso-8859-1"},
+		Body:    []byte("caf\xe9"),
+	}
+
+	text, err = fetched.Text()
+	if err != nil || text != "café" {
+		t.Errorf("unexpected fetched text: %v, err: %v", text, err)
+	}
+}
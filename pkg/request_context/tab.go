@@ -0,0 +1,209 @@
+package requestcontext
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// popupBuffer is how many popups can wait for WaitPopup before new ones are only available through Tabs
+const popupBuffer = 16
+
+var ErrNoPopup = errors.New("no popup was opened")
+
+// Tab is another page of the browser run by a CDPContext. It has its own State and capture,
+// instructions on different tabs can run concurrently.
+type Tab struct {
+	ID target.ID
+	// Opener is set for tabs opened by the site itself
+	Opener target.ID
+
+	cdp    *CDPContext
+	parent *CDPContext
+}
+
+func (t *Tab) Do(ins ...Instruction) ([]Result, error) {
+	return t.cdp.Do(ins...)
+}
+
+func (t *Tab) GetState() *State {
+	return t.cdp.GetState()
+}
+
+func (t *Tab) ClearState() {
+	t.cdp.ClearState()
+}
+
+// Close closes the page, the browser and the other tabs keep running
+func (t *Tab) Close() {
+	t.parent.removeTab(t.ID)
+	t.cdp.cancel()
+}
+
+// NewTab opens a blank page in the same browser, it shares cookies with the other tabs
+func (c *CDPContext) NewTab() (*Tab, error) {
+	ctx, cancel := chromedp.NewContext(c.ctx)
+	tab := &Tab{cdp: c.tabContext(ctx, cancel), parent: c}
+
+	err := tab.cdp.attach()
+	if err == nil {
+		err = chromedp.Run(ctx, chromedp.Navigate("about:blank"))
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	tab.ID = chromedp.FromContext(ctx).Target.TargetID
+	c.addTab(tab)
+
+	return tab, nil
+}
+
+// Tabs returns the open tabs, popups included
+func (c *CDPContext) Tabs() []*Tab {
+	c.tabsMu.Lock()
+	defer c.tabsMu.Unlock()
+
+	tabs := make([]*Tab, 0, len(c.tabs))
+	for _, tab := range c.tabs {
+		tabs = append(tabs, tab)
+	}
+
+	return tabs
+}
+
+// WaitPopup returns the next page opened by the site, from the main page or any of the tabs
+func (c *CDPContext) WaitPopup(timeout time.Duration) (*Tab, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case tab := <-c.popups:
+		return tab, nil
+	case <-timer.C:
+		return nil, ErrNoPopup
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	}
+}
+
+// tabContext creates a loader for another target of the same browser with the configuration of c.
+// The browser, the forwarder and the session store stay owned by c, navigations are counted on it.
+func (c *CDPContext) tabContext(ctx context.Context, cancel context.CancelFunc) *CDPContext {
+	c.rulesMu.RLock()
+	rules := append([]InterceptRule(nil), c.rules...)
+	c.rulesMu.RUnlock()
+
+	return &CDPContext{
+		ctx:             ctx,
+		cancel:          cancel,
+		owner:           c.root(),
+		allocator:       c.allocator,
+		allocatorCancel: c.allocatorCancel,
+		browser:         c.browser,
+		binPath:         c.binPath,
+		injectionPath:   c.injectionPath,
+		stealthModules:  c.stealthModules,
+		scripts:         c.scripts,
+		remoteURL:       c.remoteURL,
+		remoteToken:     c.remoteToken,
+		emulation:       c.emulation,
+		timeout:         c.timeout,
+		registry:        c.registry,
+		logger:          c.logger,
+		State:           &State{},
+		ProxyAgent:      c.ProxyAgent,
+		responses:       newResponseHub(),
+		rules:           rules,
+		blockDetector:   c.blockDetector,
+		sessionStore:    c.sessionStore,
+		sessionSite:     c.sessionSite,
+		sessionKey:      c.sessionKey,
+		emulatorData:    c.emulatorData,
+		osProfiles:      c.osProfiles,
+		browserVersion:  c.browserVersion,
+		versionMatch:    c.versionMatch,
+		detectedVersion: c.detectedVersion,
+		profile:         c.profile,
+		fixedProfile:    c.fixedProfile,
+		profileStore:    c.profileStore,
+		profileKey:      c.profileKey,
+		exitIPURL:       c.exitIPURL,
+		exitIP:          c.exitIP,
+		forwardProxy:    c.forwardProxy,
+	}
+}
+
+// root is the context that owns the browser, tabs report to it
+func (c *CDPContext) root() *CDPContext {
+	if c.owner != nil {
+		return c.owner
+	}
+	return c
+}
+
+// listenPopups attaches to pages opened by the main page or the tabs. The popup has already started
+// loading when it is attached, so its first document does not get the injection or the interception.
+func (c *CDPContext) listenPopups() {
+	main := chromedp.FromContext(c.ctx).Target.TargetID
+
+	chromedp.ListenBrowser(c.ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *target.EventTargetCreated:
+			info := ev.TargetInfo
+			if info.Type != "page" || info.OpenerID == "" || (info.OpenerID != main && !c.hasTab(info.OpenerID)) {
+				return
+			}
+
+			go c.attachPopup(info.TargetID, info.OpenerID)
+		case *target.EventTargetDestroyed:
+			c.removeTab(ev.TargetID)
+		}
+	})
+}
+
+func (c *CDPContext) attachPopup(id, opener target.ID) {
+	ctx, cancel := chromedp.NewContext(c.ctx, chromedp.WithTargetID(id))
+	tab := &Tab{ID: id, Opener: opener, cdp: c.tabContext(ctx, cancel), parent: c}
+
+	if err := tab.cdp.attach(); err != nil {
+		c.logger.Warn("cdp", "message", "failed to attach to popup", "target", id, "error", err)
+		cancel()
+		return
+	}
+
+	c.addTab(tab)
+	c.logger.Debug("cdp", "message", "popup attached", "target", id, "opener", opener)
+
+	select {
+	case c.popups <- tab:
+	default:
+		c.logger.Warn("cdp", "message", "popup buffer is full, popup is only available through Tabs", "target", id)
+	}
+}
+
+func (c *CDPContext) addTab(tab *Tab) {
+	c.tabsMu.Lock()
+	defer c.tabsMu.Unlock()
+
+	c.tabs[tab.ID] = tab
+}
+
+func (c *CDPContext) hasTab(id target.ID) bool {
+	c.tabsMu.Lock()
+	defer c.tabsMu.Unlock()
+
+	_, ok := c.tabs[id]
+	return ok
+}
+
+func (c *CDPContext) removeTab(id target.ID) {
+	c.tabsMu.Lock()
+	defer c.tabsMu.Unlock()
+
+	delete(c.tabs, id)
+}
@@ -0,0 +1,36 @@
+package requestcontext
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTabContext(t *testing.T) {
+	c := GetCDPContext(NewCDPOptions(
+		WithOS("android"),
+		WithBrowserVersion(118),
+		WithVersionMatch(VERSION_MATCH_FAIL),
+		WithSessionStore(NewFileSessionStore(t.TempDir()), "test"),
+		WithExitIPCheck("https://example.com/ip"),
+	))
+
+	tab := c.tabContext(context.Background(), func() {})
+	if len(tab.osProfiles) != 1 || tab.osProfiles[0].Name != "android" {
+		t.Errorf("os profiles were not copied: %v", tab.osProfiles)
+	}
+	if tab.browserVersion != 118 || tab.versionMatch != VERSION_MATCH_FAIL || tab.emulatorData == nil {
+		t.Errorf("version configuration was not copied")
+	}
+	if tab.sessionStore == nil || tab.sessionSite != "test" || tab.exitIPURL == "" {
+		t.Errorf("session configuration was not copied")
+	}
+
+	// Tabs of tabs count on the main page as well, the pool recycles by its count
+	nested := tab.tabContext(context.Background(), func() {})
+	tab.countNavigation()
+	nested.countNavigation()
+
+	if c.Navigations() != 2 || tab.Navigations() != 2 {
+		t.Errorf("tab navigations were not counted on the main page: %v", c.Navigations())
+	}
+}
@@ -0,0 +1,101 @@
+package requestcontext
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// countryTimezones are the zones most of the people of a country live in, keyed by ISO 3166 code
+var countryTimezones = map[string][]string{
+	"US": {"America/New_York", "America/Chicago", "America/Denver", "America/Los_Angeles"},
+	"CA": {"America/Toronto", "America/Vancouver"},
+	"MX": {"America/Mexico_City"},
+	"BR": {"America/Sao_Paulo"},
+	"AR": {"America/Argentina/Buenos_Aires"},
+	"GB": {"Europe/London"},
+	"IE": {"Europe/Dublin"},
+	"FR": {"Europe/Paris"},
+	"DE": {"Europe/Berlin"},
+	"ES": {"Europe/Madrid"},
+	"IT": {"Europe/Rome"},
+	"NL": {"Europe/Amsterdam"},
+	"BE": {"Europe/Brussels"},
+	"AT": {"Europe/Vienna"},
+	"CH": {"Europe/Zurich"},
+	"PT": {"Europe/Lisbon"},
+	"PL": {"Europe/Warsaw"},
+	"CZ": {"Europe/Prague"},
+	"LT": {"Europe/Vilnius"},
+	"LV": {"Europe/Riga"},
+	"EE": {"Europe/Tallinn"},
+	"FI": {"Europe/Helsinki"},
+	"SE": {"Europe/Stockholm"},
+	"NO": {"Europe/Oslo"},
+	"DK": {"Europe/Copenhagen"},
+	"UA": {"Europe/Kyiv"},
+	"RU": {"Europe/Moscow"},
+	"TR": {"Europe/Istanbul"},
+	"IL": {"Asia/Jerusalem"},
+	"AE": {"Asia/Dubai"},
+	"IN": {"Asia/Kolkata"},
+	"CN": {"Asia/Shanghai"},
+	"JP": {"Asia/Tokyo"},
+	"KR": {"Asia/Seoul"},
+	"SG": {"Asia/Singapore"},
+	"AU": {"Australia/Sydney", "Australia/Melbourne", "Australia/Brisbane", "Australia/Perth"},
+	"NZ": {"Pacific/Auckland"},
+	"ZA": {"Africa/Johannesburg"},
+}
+
+// languageCountries is where most of the speakers of a language without a region live
+var languageCountries = map[string]string{
+	"en": "US",
+	"de": "DE",
+	"fr": "FR",
+	"es": "ES",
+	"it": "IT",
+	"pt": "BR",
+	"nl": "NL",
+	"pl": "PL",
+	"cs": "CZ",
+	"lt": "LT",
+	"lv": "LV",
+	"et": "EE",
+	"fi": "FI",
+	"sv": "SE",
+	"nb": "NO",
+	"da": "DK",
+	"uk": "UA",
+	"ru": "RU",
+	"tr": "TR",
+	"he": "IL",
+	"hi": "IN",
+	"zh": "CN",
+	"ja": "JP",
+	"ko": "KR",
+}
+
+// localeCountry reads the country of the first language of an Accept-Language value
+func localeCountry(acceptLanguage string) string {
+	lang := strings.TrimSpace(strings.SplitN(strings.SplitN(acceptLanguage, ",", 2)[0], ";", 2)[0])
+	if lang == "" {
+		lang = "en-US"
+	}
+
+	base, region, found := strings.Cut(lang, "-")
+	if found {
+		return strings.ToUpper(region)
+	}
+
+	return languageCountries[strings.ToLower(base)]
+}
+
+// timezoneFor picks one of the timezones of the country, empty if the country is not known
+func timezoneFor(country string, rnd *rand.Rand) string {
+	zones := countryTimezones[strings.ToUpper(country)]
+	if len(zones) == 0 {
+		return ""
+	}
+
+	return zones[rnd.Intn(len(zones))]
+}
@@ -0,0 +1,28 @@
+package requestcontext
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestLocaleCountry(t *testing.T) {
+	for in, want := range map[string]string{
+		"lt-LT,en-US;q=0.8": "LT",
+		"en-gb":             "GB",
+		"de;q=0.9":          "DE",
+		"":                  "US",
+		"xx":                "",
+	} {
+		if got := localeCountry(in); got != want {
+			t.Errorf("localeCountry(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	if got := timezoneFor("lt", rnd); got != "Europe/Vilnius" {
+		t.Errorf("unexpected timezone for LT: %v", got)
+	}
+	if got := timezoneFor("", rnd); got != "" {
+		t.Errorf("unknown country should have no timezone: %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package requestcontext
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// URLPattern matches an url exactly (after normalization), by glob or by regex. The first non empty
+// field is used. Globs only know the * wildcard, same as the filters passed to network.SetBlockedURLs.
+type URLPattern struct {
+	Exact string
+	Glob  string
+	Regex *regexp.Regexp
+}
+
+func (p URLPattern) Match(u string) bool {
+	switch {
+	case p.Exact != "":
+		return sameURL(p.Exact, u)
+	case p.Glob != "":
+		return matchGlob(p.Glob, u)
+	case p.Regex != nil:
+		return p.Regex.MatchString(u)
+	default:
+		return false
+	}
+}
+
+func (p URLPattern) String() string {
+	switch {
+	case p.Exact != "":
+		return p.Exact
+	case p.Glob != "":
+		return p.Glob
+	case p.Regex != nil:
+		return p.Regex.String()
+	default:
+		return ""
+	}
+}
+
+func sameURL(a, b string) bool {
+	aURL, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	bURL, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return normalizeURL(aURL) == normalizeURL(bURL)
+}
+
+func matchGlob(glob, s string) bool {
+	parts := strings.Split(glob, "*")
+	if len(parts) == 1 {
+		return glob == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+
+	return strings.HasSuffix(s, last)
+}
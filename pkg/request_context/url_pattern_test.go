@@ -0,0 +1,31 @@
+package requestcontext
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestURLPattern(t *testing.T) {
+	cases := []struct {
+		pattern URLPattern
+		url     string
+		want    bool
+	}{
+		{URLPattern{Exact: "http://Example.com/path/"}, "http://example.com/path", true},
+		{URLPattern{Exact: "http://example.com/path"}, "http://example.com/other", false},
+		{URLPattern{Glob: "*example.com/api/*"}, "https://example.com/api/items?page=2", true},
+		{URLPattern{Glob: "*example.com/api/*"}, "https://example.com/static/app.js", false},
+		{URLPattern{Glob: "https://*.example.com/*.json"}, "https://cdn.example.com/data/items.json", true},
+		{URLPattern{Glob: "https://*.example.com/*.json"}, "https://cdn.example.com/data/items.js", false},
+		{URLPattern{Glob: "https://example.com/"}, "https://example.com/", true},
+		{URLPattern{Regex: regexp.MustCompile(`/api/v\d+/items`)}, "https://example.com/api/v2/items", true},
+		{URLPattern{Regex: regexp.MustCompile(`/api/v\d+/items`)}, "https://example.com/api/items", false},
+		{URLPattern{}, "https://example.com/", false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.pattern.Match(tc.url); got != tc.want {
+			t.Errorf("pattern %v on %v: wanted %v, got %v", tc.pattern, tc.url, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package selftest runs a loader against local pages with the checks bot detection scripts commonly do,
+// so stealth regressions show up before production does.
+package selftest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	requestcontext "github.com/dovydasdo/psec/pkg/request_context"
+)
+
+//go:embed page.html
+var page string
+
+var pageTemplate = template.Must(template.New("page").Parse(page))
+
+const DefaultTimeout = 30 * time.Second
+
+// Check is the outcome of a single detection check of the page
+type Check struct {
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail"`
+}
+
+type Report struct {
+	URL      string        `json:"url"`
+	Checks   []Check       `json:"checks"`
+	Duration time.Duration `json:"duration"`
+}
+
+// headers are what the server saw, the page compares them with what the scripts see
+type headers struct {
+	UserAgent string `json:"userAgent"`
+	Hints     string `json:"hints"`
+	Platform  string `json:"platform"`
+	Mobile    string `json:"mobile"`
+}
+
+// Handler serves the detection page
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := pageTemplate.Execute(w, headers{
+			UserAgent: r.UserAgent(),
+			Hints:     r.Header.Get("Sec-CH-UA"),
+			Platform:  r.Header.Get("Sec-CH-UA-Platform"),
+			Mobile:    r.Header.Get("Sec-CH-UA-Mobile"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func NewServer() *httptest.Server {
+	return httptest.NewServer(Handler())
+}
+
+// Run loads the page at url with the initialized loader and collects the results of its checks
+func Run(l requestcontext.Loader, url string, timeout time.Duration) (*Report, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var raw string
+	start := time.Now()
+
+	results, err := l.Do(
+		requestcontext.NavigateInstruction{
+			URL:           url,
+			DoneCondition: requestcontext.DoneJSPredicate{Script: "Array.isArray(window.selftest)", Timeout: timeout},
+			Timeout:       timeout,
+		},
+		requestcontext.JSEvalInstruction{Script: "JSON.stringify(window.selftest)", Result: &raw},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range results {
+		if res.Error != nil {
+			return nil, fmt.Errorf("%v failed: %w", res.Type, res.Error)
+		}
+	}
+
+	report := &Report{URL: url, Duration: time.Since(start)}
+	if err := json.Unmarshal([]byte(raw), &report.Checks); err != nil {
+		return nil, fmt.Errorf("failed to read the results: %w", err)
+	}
+
+	if len(report.Checks) == 0 {
+		return nil, errors.New("the page ran no checks")
+	}
+
+	return report, nil
+}
+
+// RunLocal serves the page for the duration of the run
+func RunLocal(l requestcontext.Loader, timeout time.Duration) (*Report, error) {
+	server := NewServer()
+	defer server.Close()
+
+	return Run(l, server.URL, timeout)
+}
+
+func (r *Report) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) Failed() []Check {
+	failed := make([]Check, 0)
+	for _, check := range r.Checks {
+		if !check.Pass {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+func (r *Report) Print(w io.Writer) {
+	for _, check := range r.Checks {
+		status := "PASS"
+		if !check.Pass {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%v  %-14v %v\n", status, check.Name, check.Detail)
+	}
+
+	fmt.Fprintf(w, "\n%v of %v checks passed in %v\n", len(r.Checks)-len(r.Failed()), len(r.Checks), r.Duration.Round(time.Millisecond))
+}
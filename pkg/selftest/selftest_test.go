@@ -0,0 +1,86 @@
+package selftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	requestcontext "github.com/dovydasdo/psec/pkg/request_context"
+)
+
+func TestHandler(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("User-Agent", `Mozilla/5.0 "quoted" </script>`)
+	req.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get the page: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	page := string(body)
+
+	// The headers end up in a script, they must not be able to close it
+	if strings.Count(page, "</script>") != 1 {
+		t.Errorf("header escaped the script")
+	}
+	if !strings.Contains(page, "navigator.webdriver") {
+		t.Errorf("page is missing the checks")
+	}
+
+	resp, err = http.Get(server.URL + "/missing")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found, got %v", resp.StatusCode)
+	}
+}
+
+// fakeLoader answers with the checks it was given instead of running a browser
+type fakeLoader struct {
+	requestcontext.Loader
+	checks []Check
+}
+
+func (l *fakeLoader) Do(ins ...requestcontext.Instruction) ([]requestcontext.Result, error) {
+	data, _ := json.Marshal(l.checks)
+	*ins[1].(requestcontext.JSEvalInstruction).Result.(*string) = string(data)
+	return []requestcontext.Result{{Type: "navigate"}, {Type: "js_eval"}}, nil
+}
+
+func TestRun(t *testing.T) {
+	loader := &fakeLoader{checks: []Check{
+		{Name: "webdriver", Pass: true, Detail: "navigator.webdriver is false"},
+		{Name: "webgl", Pass: false, Detail: "Google Inc. / SwiftShader"},
+	}}
+
+	report, err := RunLocal(loader, 0)
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+
+	if report.Passed() || len(report.Failed()) != 1 || report.Failed()[0].Name != "webgl" {
+		t.Errorf("unexpected result: %+v", report.Checks)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "FAIL  webgl") || !strings.Contains(out.String(), "1 of 2 checks passed") {
+		t.Errorf("unexpected report:\n%v", out.String())
+	}
+
+	loader.checks = nil
+	if _, err := RunLocal(loader, 0); err == nil {
+		t.Errorf("expected an error without checks")
+	}
+}
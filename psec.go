@@ -35,6 +35,11 @@ func New(options *Options) *PSEC {
 			}
 			ec.rctx = r.GetCDPContext(v)
 			break
+		case *r.HTTPOptions:
+			if ec.rctx != nil {
+				break
+			}
+			ec.rctx = r.GetHTTPContext(v)
 		default:
 			ec.logger.Warn("init", "message", "provided request agent is not supported")
 		}
@@ -111,7 +116,12 @@ func (c *PSEC) Start(limit int) error {
 			c.logger.Info("psec", "message", "Got nil error, collection complete, terminating")
 			return nil
 		case perrors.Blocked:
-			c.logger.Info("psec", "message", "Got blocked error, resetting and retrying", "error", err.Error())
+			if v.Action == perrors.BLOCKED_TERMINATE {
+				c.logger.Info("psec", "message", "Got blocked error, terminating", "error", err.Error(), "reason", v.Reason)
+				return v
+			}
+
+			c.logger.Info("psec", "message", "Got blocked error, resetting and retrying", "error", err.Error(), "reason", v.Reason)
 			err = c.rctx.ChangeProxy()
 			if err != nil {
 				// If no proxies, terminate immediately
@@ -1,7 +1,52 @@
 package psec
 
-import "testing"
+import (
+	"log/slog"
+	"testing"
+
+	r "github.com/dovydasdo/psec/pkg/request_context"
+	sc "github.com/dovydasdo/psec/pkg/save_context"
+	perrors "github.com/dovydasdo/psec/util/errors"
+)
 
 func TestPSEC(t *testing.T) {
 
 }
+
+type countingLoader struct {
+	r.Loader
+	changes int
+	resets  int
+}
+
+func (l *countingLoader) ChangeProxy() error { l.changes++; return nil }
+func (l *countingLoader) Reset()             { l.resets++ }
+
+func TestStartBlocked(t *testing.T) {
+	loader := &countingLoader{}
+	p := &PSEC{rctx: loader, logger: slog.Default()}
+
+	runs := 0
+	p.AddStartFunc(func(c r.Loader, s sc.Saver, l *slog.Logger) error {
+		runs++
+		if runs == 1 {
+			// No Action set, it has to be retried
+			return perrors.Blocked{Reason: "blocked"}
+		}
+		return nil
+	})
+
+	if err := p.Start(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runs != 2 || loader.changes != 1 || loader.resets != 1 {
+		t.Errorf("expected a retry, got %v runs, %v proxy changes, %v resets", runs, loader.changes, loader.resets)
+	}
+
+	p.AddStartFunc(func(c r.Loader, s sc.Saver, l *slog.Logger) error {
+		return perrors.Blocked{Action: perrors.BLOCKED_TERMINATE}
+	})
+	if _, ok := p.Start(3).(perrors.Blocked); !ok {
+		t.Errorf("expected the terminating block to be returned")
+	}
+}
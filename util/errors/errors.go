@@ -1,14 +1,19 @@
 package perrors
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // 	Types:
 // 		* Blocked
 //		* Extraction failed
+//		* Timeout
 
+// Retry is the zero value so a Blocked without an Action resets and retries
 const (
-	BLOCKED_TERMINATE = iota
-	BLOCKED_RETRY
+	BLOCKED_RETRY = iota
+	BLOCKED_TERMINATE
 )
 
 const (
@@ -36,3 +41,12 @@ type ExtractionFailed struct {
 func (f ExtractionFailed) Error() string {
 	return fmt.Sprintf("Extraction failed: %v", f.Reason)
 }
+
+type Timeout struct {
+	Reason string
+	After  time.Duration
+}
+
+func (t Timeout) Error() string {
+	return fmt.Sprintf("Timed out after %v: %v", t.After, t.Reason)
+}
@@ -4,13 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"math"
-	"net/http"
+	"sort"
 )
 
 // Consider options for other browsers if bidi support is added
-// TODO: Dont rely on hardcoded links
 
 type UAMetadata struct {
 	JsHighEntropyHints JsHighEntropyHints `json:"jsHighEntropyHints"`
@@ -38,6 +35,43 @@ type NavigatorInfo struct {
 			Value string `json:"_$value"`
 		} `json:"platform"`
 	} `json:"navigator"`
+	// Values holds every string, number and boolean property of the navigator
+	Values map[string]interface{} `json:"-"`
+}
+
+type navigatorValue struct {
+	Type  string      `json:"_$type"`
+	Value interface{} `json:"_$value"`
+}
+
+func (n *NavigatorInfo) UnmarshalJSON(data []byte) error {
+	type plain NavigatorInfo
+	if err := json.Unmarshal(data, (*plain)(n)); err != nil {
+		return err
+	}
+
+	raw := struct {
+		Navigator map[string]json.RawMessage `json:"navigator"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	n.Values = make(map[string]interface{})
+	for name, prop := range raw.Navigator {
+		value := navigatorValue{}
+		// Functions and objects have a different shape, only plain values are kept
+		if err := json.Unmarshal(prop, &value); err != nil {
+			continue
+		}
+
+		switch value.Type {
+		case "string", "number", "boolean":
+			n.Values[name] = value.Value
+		}
+	}
+
+	return nil
 }
 
 type Brand struct {
@@ -55,64 +89,121 @@ type UserAgentInfo struct {
 	AcceptLanguage string
 	Platform       string
 	Metadata       UAMetadata
+	// OS is the name of the OSProfile the data is for
+	OS        string
+	Navigator map[string]interface{}
 }
 
 type VersionInfo []struct {
 	Version int `json:"majorVersion"`
 }
 
+// DefaultPlatform is the os directory of the dataset used when no os is picked
+const DefaultPlatform = "as-windows-10"
+
+func clientHintsPath(version int, platform string) string {
+	return fmt.Sprintf("as-chrome-%v-0/%v/user-agent-hints.json", version, platform)
+}
+
+func navigatorPath(version int, platform string) string {
+	return fmt.Sprintf("as-chrome-%v-0/%v/window-navigator.json", version, platform)
+}
+
+// versionSource serves a version from the snapshot if it has it and downloads the others, the
+// getters of a single version are not limited to what was embedded
+var versionSource Source = FallbackSource{EmbeddedSource{}, NewHTTPSource()}
+
 func GetClientHints(version int) (UAMetadata, error) {
-	// have some backup info providers
-	return fetch[UAMetadata](fmt.Sprintf("https://raw.githubusercontent.com/ulixee/unblocked-emulator-data/main/as-chrome-%v-0/as-windows-10/user-agent-hints.json", version))
-	// todo: some validation?
+	return load[UAMetadata](versionSource, clientHintsPath(version, DefaultPlatform))
 }
 
 func GetNavigator(version int) (NavigatorInfo, error) {
-	return fetch[NavigatorInfo](fmt.Sprintf("https://raw.githubusercontent.com/ulixee/unblocked-emulator-data/main/as-chrome-%v-0/as-windows-10/window-navigator.json", version))
-	// todo: some validation?
+	return load[NavigatorInfo](versionSource, navigatorPath(version, DefaultPlatform))
 }
 
 func GetLatestInfo(lang string) (UserAgentInfo, error) {
+	return GetLatestInfoFrom(DefaultSource, lang)
+}
+
+// GetLatestInfoFrom reads the newest version of the default os the source has
+func GetLatestInfoFrom(source Source, lang string) (UserAgentInfo, error) {
+	return GetInfo(source, 0, OSProfiles[0], lang)
+}
+
+// GetInfo reads the data of the browser version on the os, zero version means the newest one
+func GetInfo(source Source, version int, os OSProfile, lang string) (UserAgentInfo, error) {
 	data := UserAgentInfo{}
-	latestInfo, err := fetch[VersionInfo]("https://raw.githubusercontent.com/ulixee/unblocked-emulator-data/main/browserEngineOptions.json")
 
-	if len(latestInfo) < 1 {
-		return data, errors.New("no info about versions found")
-	}
+	if version == 0 {
+		versions, err := source.Get(browserEngineOption)
+		if err != nil {
+			return data, err
+		}
 
-	latest := math.MinInt
-	for _, i := range latestInfo {
-		if latest < int(i.Version) {
-			latest = int(i.Version)
+		latest, err := latestVersions(versions, 1)
+		if err != nil {
+			return data, err
 		}
+		version = latest[0]
 	}
 
-	ch, err := GetClientHints(latest)
+	ch, err := load[UAMetadata](source, clientHintsPath(version, os.Dir))
 	if err != nil {
 		return data, err
 	}
 
-	nav, err := GetNavigator(latest)
+	nav, err := load[NavigatorInfo](source, navigatorPath(version, os.Dir))
 	if err != nil {
 		return data, err
 	}
 
+	if nav.Navigator.UserAgent.Value == "" || len(ch.JsHighEntropyHints.Brands) == 0 {
+		return data, fmt.Errorf("incomplete emulator data for version %v on %v", version, os.Name)
+	}
+
 	data.UserAgent = nav.Navigator.UserAgent.Value
 	data.Platform = nav.Navigator.Platform.Value
 	data.Metadata = ch
 	data.AcceptLanguage = lang
+	data.OS = os.Name
+	data.Navigator = nav.Values
 
-	return data, err // todo: some validation?
+	return data, nil
 }
 
-func fetch[T any](url string) (T, error) {
-	data := new(T)
-	resp, err := http.Get(url)
-	if err != nil {
-		return *data, err
+// latestVersions returns up to n of the newest major versions, newest first
+func latestVersions(data []byte, n int) ([]int, error) {
+	info := VersionInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	if len(info) < 1 {
+		return nil, errors.New("no info about versions found")
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	versions := make([]int, 0, len(info))
+	seen := make(map[int]bool)
+	for _, i := range info {
+		if !seen[i.Version] {
+			seen[i.Version] = true
+			versions = append(versions, i.Version)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	if n > 0 && len(versions) > n {
+		versions = versions[:n]
+	}
+
+	return versions, nil
+}
+
+func load[T any](source Source, name string) (T, error) {
+	data := new(T)
+
+	body, err := source.Get(name)
 	if err != nil {
 		return *data, err
 	}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"math/rand"
 	"strconv"
 	"strings"
 	"testing"
@@ -24,3 +25,61 @@ func TestGetClientHints(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestGetLatestInfo(t *testing.T) {
+	info, err := GetLatestInfo("en-US")
+	if err != nil {
+		t.Fatalf("failed to read the embedded snapshot: %v", err)
+	}
+
+	if info.UserAgent == "" || len(info.Metadata.JsHighEntropyHints.Brands) == 0 {
+		t.Errorf("incomplete info: %+v", info)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	for _, os := range OSProfiles {
+		info, err := GetInfo(EmbeddedSource{}, 118, os, "en-US")
+		if err != nil {
+			t.Errorf("%v: failed to read the snapshot: %v", os.Name, err)
+			continue
+		}
+
+		if info.OS != os.Name || info.Navigator["userAgent"] != info.UserAgent {
+			t.Errorf("%v: navigator data was not read: %+v", os.Name, info)
+		}
+
+		if _, ok := info.Navigator["hardwareConcurrency"].(float64); !ok {
+			t.Errorf("%v: numbers were not kept: %v", os.Name, info.Navigator)
+		}
+	}
+
+	android, _ := GetOSProfile("android")
+	info, _ := GetInfo(EmbeddedSource{}, 0, android, "en-US")
+	if !info.Metadata.JsHighEntropyHints.Mobile || info.Navigator["maxTouchPoints"] != float64(5) {
+		t.Errorf("android data is not mobile: %+v", info)
+	}
+
+	_, err := GetOSUAInfo(EmbeddedSource{}, 99, android)
+	if err == nil {
+		t.Errorf("missing version should be reported")
+	}
+}
+
+func TestPickOS(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	profiles := []OSProfile{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}, {Name: "c", Weight: 0}}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[PickOS(profiles, rnd).Name]++
+	}
+
+	if counts["c"] != 0 {
+		t.Errorf("profile without weight was picked")
+	}
+
+	if counts["a"] < 2700 || counts["a"] > 3300 {
+		t.Errorf("weights were not respected: %v", counts)
+	}
+}
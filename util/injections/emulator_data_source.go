@@ -0,0 +1,195 @@
+package util
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot of the emulator dataset, refreshed with cmd/emulator-data. Paths are the same as in the
+// upstream repository so every source can serve the same files.
+//
+//go:embed data
+var snapshot embed.FS
+
+const (
+	EmulatorDataURL     = "https://raw.githubusercontent.com/ulixee/unblocked-emulator-data/main"
+	DefaultHTTPTimeout  = 10 * time.Second
+	DefaultCacheTTL     = 24 * time.Hour
+	browserEngineOption = "browserEngineOptions.json"
+)
+
+// Source serves files of the emulator dataset by their path in the dataset
+type Source interface {
+	Get(name string) ([]byte, error)
+}
+
+// DefaultSource only uses the embedded snapshot, so startup never depends on the network
+var DefaultSource Source = EmbeddedSource{}
+
+// EmbeddedSource serves the snapshot built into the binary
+type EmbeddedSource struct{}
+
+func (EmbeddedSource) Get(name string) ([]byte, error) {
+	return fs.ReadFile(snapshot, path.Join("data", name))
+}
+
+// HTTPSource downloads the files, non 200 responses are errors
+type HTTPSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewHTTPSource() *HTTPSource {
+	return &HTTPSource{
+		BaseURL: EmulatorDataURL,
+		Client:  &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+}
+
+func (s *HTTPSource) Get(name string) ([]byte, error) {
+	resp, err := s.Client.Get(s.BaseURL + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %v: %v", name, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// CacheSource keeps files from Upstream in Dir. Files older than TTL are downloaded again, if that
+// fails the stale file is still used.
+type CacheSource struct {
+	Dir      string
+	TTL      time.Duration
+	Upstream Source
+}
+
+func NewCacheSource(dir string, ttl time.Duration, upstream Source) *CacheSource {
+	return &CacheSource{Dir: dir, TTL: ttl, Upstream: upstream}
+}
+
+// DefaultCacheDir is in the user cache directory, or the temp directory if there is none
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "psec", "emulator-data")
+}
+
+func (s *CacheSource) Get(name string) ([]byte, error) {
+	file := filepath.Join(s.Dir, filepath.FromSlash(name))
+
+	info, statErr := os.Stat(file)
+	if statErr == nil && time.Since(info.ModTime()) < s.TTL {
+		return os.ReadFile(file)
+	}
+
+	data, err := s.Upstream.Get(name)
+	if err != nil {
+		if statErr == nil {
+			return os.ReadFile(file)
+		}
+		return nil, err
+	}
+
+	if err := writeFile(file, data); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// FallbackSource returns the file from the first source that has it
+type FallbackSource []Source
+
+func (s FallbackSource) Get(name string) ([]byte, error) {
+	errs := make([]error, 0, len(s))
+	for _, source := range s {
+		data, err := source.Get(name)
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no sources")
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// NewOnlineSource keeps the dataset fresh through the cache and falls back to the snapshot when offline
+func NewOnlineSource(cacheDir string, ttl time.Duration) Source {
+	return FallbackSource{
+		NewCacheSource(cacheDir, ttl, NewHTTPSource()),
+		EmbeddedSource{},
+	}
+}
+
+// Refresh downloads the latest versions of the dataset for the platforms into dir, in the layout of the snapshot.
+// The version list is written last, a failed download does not point readers at versions without data.
+func Refresh(from Source, dir string, versions int, platforms ...string) ([]int, error) {
+	index, err := from.Get(browserEngineOption)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := latestVersions(index, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, version := range latest {
+		for _, platform := range platforms {
+			files = append(files,
+				clientHintsPath(version, platform),
+				navigatorPath(version, platform),
+			)
+		}
+	}
+
+	for _, name := range files {
+		data, err := from.Get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeFile(filepath.Join(dir, filepath.FromSlash(browserEngineOption)), index); err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+func writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type countingSource struct {
+	calls int
+	err   error
+}
+
+func (s *countingSource) Get(name string) ([]byte, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return EmbeddedSource{}.Get(name)
+}
+
+func TestCacheSource(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &countingSource{}
+	cache := NewCacheSource(dir, time.Hour, upstream)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(browserEngineOption); err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+	}
+
+	if upstream.calls != 1 {
+		t.Errorf("fresh file was downloaded again, calls: %v", upstream.calls)
+	}
+
+	// Expired and offline, the stale file is still used
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, browserEngineOption), old, old)
+	upstream.err = errors.New("offline")
+
+	if _, err := cache.Get(browserEngineOption); err != nil {
+		t.Errorf("stale file was not used: %v", err)
+	}
+
+	if upstream.calls != 2 {
+		t.Errorf("expired file was not downloaded again")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+browserEngineOption {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"majorVersion":119},{"majorVersion":118}]`))
+	}))
+	defer ts.Close()
+
+	source := NewHTTPSource()
+	source.BaseURL = ts.URL
+
+	if _, err := source.Get(browserEngineOption); err != nil {
+		t.Errorf("failed to get: %v", err)
+	}
+
+	if _, err := source.Get("missing.json"); err == nil {
+		t.Errorf("not found response should be an error")
+	}
+
+	// 119 is only in the version list, its files are missing
+	_, err := GetLatestInfoFrom(FallbackSource{source}, "en-US")
+	if err == nil {
+		t.Errorf("missing version files should be an error")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	dir := t.TempDir()
+
+	versions, err := Refresh(EmbeddedSource{}, dir, 1, DefaultPlatform, "as-android-13")
+	if err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+
+	if len(versions) != 1 || versions[0] != 118 {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+
+	info, err := GetLatestInfoFrom(NewCacheSource(dir, time.Hour, &countingSource{err: errors.New("offline")}), "en-US")
+	if err != nil {
+		t.Fatalf("refreshed data can not be read: %v", err)
+	}
+
+	if info.Metadata.JsHighEntropyHints.UaFullVersion != "118.0.5993.71" {
+		t.Errorf("unexpected version: %v", info.Metadata.JsHighEntropyHints.UaFullVersion)
+	}
+
+	// A platform that failed to download must not leave a version list behind
+	partial := t.TempDir()
+	if _, err := Refresh(EmbeddedSource{}, partial, 1, DefaultPlatform, "as-missing"); err == nil {
+		t.Fatalf("expected an error for a missing platform")
+	}
+
+	if _, err := os.Stat(filepath.Join(partial, browserEngineOption)); !os.IsNotExist(err) {
+		t.Errorf("version list was written although a platform failed: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// OSProfile is an os the browser data is available for, Dir is its directory in the dataset
+type OSProfile struct {
+	Name   string
+	Dir    string
+	Weight int
+}
+
+// OSProfiles are weighted roughly by the share of chrome users, the first one is the default
+var OSProfiles = []OSProfile{
+	{Name: "windows-10", Dir: "as-windows-10", Weight: 45},
+	{Name: "windows-11", Dir: "as-windows-11", Weight: 25},
+	{Name: "macos", Dir: "as-mac-os-14", Weight: 15},
+	{Name: "linux", Dir: "as-linux", Weight: 5},
+	{Name: "android", Dir: "as-android-13", Weight: 10},
+}
+
+func GetOSProfile(name string) (OSProfile, error) {
+	for _, os := range OSProfiles {
+		if os.Name == name {
+			return os, nil
+		}
+	}
+
+	return OSProfile{}, fmt.Errorf("unknown os profile: %v", name)
+}
+
+// PickOS picks a profile at random by weight, profiles without weight are never picked
+func PickOS(profiles []OSProfile, rnd *rand.Rand) OSProfile {
+	total := 0
+	for _, os := range profiles {
+		if os.Weight > 0 {
+			total += os.Weight
+		}
+	}
+
+	if total == 0 {
+		return OSProfiles[0]
+	}
+
+	n := rnd.Intn(total)
+	for _, os := range profiles {
+		if os.Weight <= 0 {
+			continue
+		}
+
+		if n < os.Weight {
+			return os
+		}
+		n -= os.Weight
+	}
+
+	return profiles[len(profiles)-1]
+}
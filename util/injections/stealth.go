@@ -0,0 +1,93 @@
+package util
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed stealth/*.js
+var stealthFiles embed.FS
+
+// Modules of the stealth bundle in the order they are injected
+const (
+	STEALTH_WEBDRIVER      = "webdriver"
+	STEALTH_PLUGINS        = "plugins"
+	STEALTH_PERMISSIONS    = "permissions"
+	STEALTH_CHROME_RUNTIME = "chrome.runtime"
+	STEALTH_IFRAME         = "iframe.contentWindow"
+)
+
+var stealthModules = []string{
+	STEALTH_WEBDRIVER,
+	STEALTH_PLUGINS,
+	STEALTH_PERMISSIONS,
+	STEALTH_CHROME_RUNTIME,
+	STEALTH_IFRAME,
+}
+
+// StealthModules returns the names of all the modules of the bundle
+func StealthModules() []string {
+	return append([]string(nil), stealthModules...)
+}
+
+// StealthScript bundles the modules into one script, they run in the default order whatever the order
+// of the names. A failing module does not stop the others, no modules give an empty script.
+func StealthScript(modules ...string) (string, error) {
+	if len(modules) == 0 {
+		return "", nil
+	}
+
+	return StealthBundle("", modules...)
+}
+
+// StealthBundle bundles the modules with extra code that runs after them. The shared utils are in
+// scope of the extra code, so it can make its patches look native without patching toString again.
+func StealthBundle(extra string, modules ...string) (string, error) {
+	enabled := make(map[string]bool, len(modules))
+	for _, name := range modules {
+		if !isStealthModule(name) {
+			return "", fmt.Errorf("unknown stealth module %q", name)
+		}
+		enabled[name] = true
+	}
+
+	utils, err := stealthFiles.ReadFile("stealth/utils.js")
+	if err != nil {
+		return "", err
+	}
+
+	var script strings.Builder
+	script.WriteString("(() => {\n")
+	script.Write(utils)
+
+	for _, name := range stealthModules {
+		if !enabled[name] {
+			continue
+		}
+
+		module, err := stealthFiles.ReadFile("stealth/" + name + ".js")
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&script, "try {\n%s} catch (e) {}\n", module)
+	}
+
+	if extra != "" {
+		fmt.Fprintf(&script, "try {\n%s\n} catch (e) {}\n", extra)
+	}
+
+	script.WriteString("})();\n")
+
+	return script.String(), nil
+}
+
+func isStealthModule(name string) bool {
+	for _, module := range stealthModules {
+		if module == name {
+			return true
+		}
+	}
+	return false
+}
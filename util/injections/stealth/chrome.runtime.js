@@ -0,0 +1,24 @@
+// window.chrome is missing in headless, runtime is only there on secure origins
+if (!window.chrome) {
+	Object.defineProperty(window, 'chrome', {value: {}, writable: true, enumerable: true, configurable: false});
+}
+
+if (!window.chrome.runtime && location.protocol === 'https:') {
+	const noExtension = (name) => utils.makeNative(function () {
+		throw new TypeError(`Error in invocation of runtime.${name}(): chrome.runtime.${name}() called from a webpage must specify an Extension ID (string) for its first argument.`);
+	}, name);
+
+	window.chrome.runtime = {
+		OnInstalledReason: {CHROME_UPDATE: 'chrome_update', INSTALL: 'install', SHARED_MODULE_UPDATE: 'shared_module_update', UPDATE: 'update'},
+		OnRestartRequiredReason: {APP_UPDATE: 'app_update', OS_UPDATE: 'os_update', PERIODIC: 'periodic'},
+		PlatformArch: {ARM: 'arm', ARM64: 'arm64', MIPS: 'mips', MIPS64: 'mips64', X86_32: 'x86-32', X86_64: 'x86-64'},
+		PlatformNaclArch: {ARM: 'arm', MIPS: 'mips', MIPS64: 'mips64', X86_32: 'x86-32', X86_64: 'x86-64'},
+		PlatformOs: {ANDROID: 'android', CROS: 'cros', LINUX: 'linux', MAC: 'mac', OPENBSD: 'openbsd', WIN: 'win'},
+		RequestUpdateCheckStatus: {NO_UPDATE: 'no_update', THROTTLED: 'throttled', UPDATE_AVAILABLE: 'update_available'},
+		get id() {
+			return undefined;
+		},
+		connect: noExtension('connect'),
+		sendMessage: noExtension('sendMessage'),
+	};
+}
@@ -0,0 +1,13 @@
+// The injection does not run in srcdoc frames, their windows get the chrome object of the parent
+{
+	const get = Object.getOwnPropertyDescriptor(HTMLIFrameElement.prototype, 'contentWindow').get;
+	utils.replaceGetter(HTMLIFrameElement.prototype, 'contentWindow', function () {
+		const win = get.call(this);
+		try {
+			if (win && !win.chrome && window.chrome) {
+				Object.defineProperty(win, 'chrome', {value: window.chrome, writable: true, enumerable: true, configurable: false});
+			}
+		} catch (e) {}
+		return win;
+	});
+}
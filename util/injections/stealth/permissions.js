@@ -0,0 +1,11 @@
+// Headless denies notifications while the permissions api still reports prompt
+if (window.Notification && window.Permissions) {
+	const query = Permissions.prototype.query;
+	Permissions.prototype.query = utils.makeNative(function query(parameters) {
+		if (parameters && parameters.name === 'notifications') {
+			const state = Notification.permission === 'default' ? 'prompt' : Notification.permission;
+			return Promise.resolve(Object.setPrototypeOf({state: state, onchange: null}, PermissionStatus.prototype));
+		}
+		return query.apply(this, arguments);
+	});
+}
@@ -0,0 +1,52 @@
+// Headless has no plugins, regular Chrome always lists the same pdf viewers
+if (navigator.plugins.length === 0) {
+	const mimes = [
+		{type: 'application/pdf', suffixes: 'pdf', description: 'Portable Document Format'},
+		{type: 'text/pdf', suffixes: 'pdf', description: 'Portable Document Format'},
+	];
+	const names = ['PDF Viewer', 'Chrome PDF Viewer', 'Chromium PDF Viewer', 'Microsoft Edge PDF Viewer', 'WebKit built-in PDF'];
+
+	const list = (proto, items, key) => {
+		const arr = Object.create(proto);
+		items.forEach((item, i) => {
+			Object.defineProperty(arr, i, {value: item, enumerable: true});
+			Object.defineProperty(arr, item[key], {value: item});
+		});
+		Object.defineProperty(arr, 'length', {value: items.length});
+		Object.defineProperty(arr, 'item', {value: utils.makeNative(function item(i) { return items[i] || null; })});
+		Object.defineProperty(arr, 'namedItem', {value: utils.makeNative(function namedItem(name) { return items.find((item) => item[key] === name) || null; })});
+		return arr;
+	};
+
+	const mimeTypes = mimes.map((data) => Object.create(MimeType.prototype, {
+		type: {value: data.type, enumerable: true},
+		suffixes: {value: data.suffixes, enumerable: true},
+		description: {value: data.description, enumerable: true},
+	}));
+
+	const plugins = names.map((name) => {
+		const plugin = list(Plugin.prototype, mimeTypes, 'type');
+		Object.defineProperties(plugin, {
+			name: {value: name, enumerable: true},
+			filename: {value: 'internal-pdf-viewer', enumerable: true},
+			description: {value: 'Portable Document Format', enumerable: true},
+		});
+		return plugin;
+	});
+
+	mimeTypes.forEach((mime) => Object.defineProperty(mime, 'enabledPlugin', {value: plugins[0], enumerable: true}));
+
+	const pluginArray = list(PluginArray.prototype, plugins, 'name');
+	Object.defineProperty(pluginArray, 'refresh', {value: utils.makeNative(function refresh() {})});
+	const mimeTypeArray = list(MimeTypeArray.prototype, mimeTypes, 'type');
+
+	utils.replaceGetter(Navigator.prototype, 'plugins', function () {
+		return pluginArray;
+	});
+	utils.replaceGetter(Navigator.prototype, 'mimeTypes', function () {
+		return mimeTypeArray;
+	});
+	utils.replaceGetter(Navigator.prototype, 'pdfViewerEnabled', function () {
+		return true;
+	});
+}
@@ -0,0 +1,25 @@
+// Shared by the modules: patched functions and getters have to look native to toString
+const utils = {};
+{
+	const names = new WeakMap();
+	const nativeToString = Function.prototype.toString;
+	const patched = function toString() {
+		return names.has(this) ? names.get(this) : nativeToString.call(this);
+	};
+	names.set(patched, 'function toString() { [native code] }');
+	Function.prototype.toString = patched;
+
+	utils.makeNative = (fn, name) => {
+		names.set(fn, `function ${name || fn.name}() { [native code] }`);
+		return fn;
+	};
+
+	utils.replaceGetter = (obj, prop, getter) => {
+		const desc = Object.getOwnPropertyDescriptor(obj, prop) || {configurable: true, enumerable: true};
+		Object.defineProperty(obj, prop, {
+			configurable: desc.configurable,
+			enumerable: desc.enumerable,
+			get: utils.makeNative(getter, `get ${prop}`),
+		});
+	};
+}
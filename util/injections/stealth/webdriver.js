@@ -0,0 +1,4 @@
+// A browser that is not automated reports false, not undefined
+utils.replaceGetter(Navigator.prototype, 'webdriver', function () {
+	return false;
+});
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStealthScript(t *testing.T) {
+	all, err := StealthScript(StealthModules()...)
+	if err != nil {
+		t.Fatalf("failed to bundle: %v", err)
+	}
+
+	for _, marker := range []string{"'webdriver'", "PluginArray", "Permissions.prototype.query", "chrome.runtime", "HTMLIFrameElement"} {
+		if !strings.Contains(all, marker) {
+			t.Errorf("bundle is missing %v", marker)
+		}
+	}
+
+	some, err := StealthScript(STEALTH_PERMISSIONS, STEALTH_WEBDRIVER)
+	if err != nil {
+		t.Fatalf("failed to bundle: %v", err)
+	}
+	if strings.Contains(some, "PluginArray") {
+		t.Errorf("disabled module was bundled")
+	}
+	if strings.Index(some, "'webdriver'") > strings.Index(some, "Permissions.prototype.query") {
+		t.Errorf("modules are not in the default order")
+	}
+
+	if script, _ := StealthScript(); script != "" {
+		t.Errorf("expected an empty script without modules")
+	}
+
+	if _, err := StealthScript("nope"); err == nil {
+		t.Errorf("expected an error for an unknown module")
+	}
+}
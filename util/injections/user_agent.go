@@ -1,13 +1,28 @@
 package util
 
 func GetLatestUAInfo() (UserAgentInfo, error) {
-	// would be nice to have some enpoint to reliably fetch this info
-	info, err := GetLatestInfo("en-US")
-	if err != nil {
-		return GetStaticUAInfo(), err
+	return GetUAInfo(DefaultSource)
+}
+
+// GetUAInfo returns the newest data of the source, or the static data if the source fails
+func GetUAInfo(source Source) (UserAgentInfo, error) {
+	return GetOSUAInfo(source, 0, OSProfiles[0])
+}
+
+// GetOSUAInfo falls back to the newest version of the os in the embedded snapshot if the source does
+// not have the data, and to the static data as the last resort. The error of the source is returned
+// with the fallback data.
+func GetOSUAInfo(source Source, version int, os OSProfile) (UserAgentInfo, error) {
+	info, err := GetInfo(source, version, os, "en-US")
+	if err == nil {
+		return info, nil
+	}
+
+	if fallback, fallbackErr := GetInfo(EmbeddedSource{}, 0, os, "en-US"); fallbackErr == nil {
+		return fallback, err
 	}
 
-	return info, nil
+	return GetStaticUAInfo(), err
 }
 
 func GetStaticUAInfo() UserAgentInfo {
@@ -15,6 +30,7 @@ func GetStaticUAInfo() UserAgentInfo {
 		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
 		AcceptLanguage: "en-US",
 		Platform:       "Win32",
+		OS:             "windows-10",
 		Metadata: UAMetadata{
 			JsHighEntropyHints: JsHighEntropyHints{
 				Brands: []Brand{